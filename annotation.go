@@ -0,0 +1,129 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	knative "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+// ServiceConfig holds the documented Cloud Run annotations of the current
+// service, see LoadServiceConfig. Fields of annotations which are not set
+// hold their zero value, except for CPUThrottling, which defaults to true like
+// on Cloud Run. VPCAccessEgress is normalized like by the VPCAccessEgress
+// accessor.
+type ServiceConfig struct {
+	// Service annotations
+	Creator                       string `annotation:"serving.knative.dev/creator"`
+	LastModifier                  string `annotation:"serving.knative.dev/lastModifier"`
+	LaunchStage                   string `annotation:"run.googleapis.com/launch-stage"`
+	Description                   string `annotation:"run.googleapis.com/description"`
+	Ingress                       string `annotation:"run.googleapis.com/ingress"`
+	IngressStatus                 string `annotation:"run.googleapis.com/ingress-status"`
+	BinaryAuthorizationPolicy     string `annotation:"run.googleapis.com/binary-authorization"`
+	BinaryAuthorizationBreakglass string `annotation:"run.googleapis.com/binary-authorization-breakglass"`
+	ServiceMinimumInstances       int    `annotation:"run.googleapis.com/minScale"`
+	FunctionEntryPoint            string `annotation:"run.googleapis.com/function-target"`
+	InvokerIAMDisabled            bool   `annotation:"run.googleapis.com/invoker-iam-disabled"`
+	IAPEnabled                    bool   `annotation:"run.googleapis.com/iap-enabled"`
+	ScalingMode                   string `annotation:"run.googleapis.com/scalingMode"`
+	ManualInstances               int    `annotation:"run.googleapis.com/manualInstanceCount"`
+
+	// Revision template annotations
+	RevisionMinimumInstances   int      `annotation:"autoscaling.knative.dev/minScale"`
+	RevisionMaximumInstances   int      `annotation:"autoscaling.knative.dev/maxScale"`
+	CPUThrottling              bool     `annotation:"run.googleapis.com/cpu-throttling"`
+	StartupCPUBoost            bool     `annotation:"run.googleapis.com/startup-cpu-boost"`
+	SessionAffinity            bool     `annotation:"run.googleapis.com/sessionAffinity"`
+	CloudSQLInstances          []string `annotation:"run.googleapis.com/cloudsql-instances"`
+	ExecutionEnvironment       string   `annotation:"run.googleapis.com/execution-environment"`
+	VPCAccessConnector         string   `annotation:"run.googleapis.com/vpc-access-connector"`
+	VPCAccessEgress            string   `annotation:"run.googleapis.com/vpc-access-egress"`
+	VPCNetworkInterfaces       string   `annotation:"run.googleapis.com/network-interfaces"`
+	EncryptionKey              string   `annotation:"run.googleapis.com/encryption-key"`
+	EncryptionKeyShutdownHours int      `annotation:"run.googleapis.com/encryption-key-shutdown-hours"`
+	PostKeyRevocationAction    string   `annotation:"run.googleapis.com/post-key-revocation-action-type"`
+	Secrets                    string   `annotation:"run.googleapis.com/secrets"`
+	GPUZonalRedundancyDisabled bool     `annotation:"run.googleapis.com/gpu-zonal-redundancy-disabled"`
+}
+
+// LoadServiceConfig returns the annotations of the current service parsed
+// from KNativeService. The result is cached, see ResetCache.
+func LoadServiceConfig() (ServiceConfig, error) {
+	if this.serviceConfig != nil {
+		return *this.serviceConfig, nil
+	}
+	service, err := KNativeService()
+	if err != nil {
+		return ServiceConfig{}, err
+	}
+	cfg, err := ParseServiceConfig(service)
+	if err != nil {
+		return cfg, err
+	}
+	this.serviceConfig = &cfg
+	return cfg, nil
+}
+
+// ParseServiceConfig parses the annotations of the service. Annotations of
+// the revision template take precedence over annotations of the service.
+// All invalid annotations are reported in the returned error.
+func ParseServiceConfig(service knative.Service) (ServiceConfig, error) {
+	cfg := ServiceConfig{CPUThrottling: true}
+	value := reflect.ValueOf(&cfg).Elem()
+	var errs []error
+	for i := range value.NumField() {
+		key := value.Type().Field(i).Tag.Get("annotation")
+		raw, ok := lookupAnnotation(service, key)
+		if !ok {
+			continue
+		}
+		if err := setBindValue(value.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid annotation '%s': %w", key, err))
+		}
+	}
+	cfg.VPCAccessEgress = normalizeVPCAccessEgress(cfg.VPCAccessEgress)
+	return cfg, errors.Join(errs...)
+}
+
+// Annotation returns the value of the annotation of the current service
+// parsed as T, e.g. `run.Annotation[int]("autoscaling.knative.dev/maxScale")`.
+// Annotations of the revision template take precedence over annotations of
+// the service. Strings, booleans, numbers, durations, comma-separated slices
+// and types implementing encoding.TextUnmarshaler are supported.
+func Annotation[T any](key string) (T, error) {
+	var value T
+	service, err := KNativeService()
+	if err != nil {
+		return value, fmt.Errorf("error loading property '%s': %v", key, err)
+	}
+	raw, ok := lookupAnnotation(service, key)
+	if !ok || raw == "" {
+		return value, fmt.Errorf("error reading property '%s'", key)
+	}
+	if err := setBindValue(reflect.ValueOf(&value).Elem(), raw); err != nil {
+		return value, fmt.Errorf("error parsing property '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+func lookupAnnotation(service knative.Service, key string) (string, bool) {
+	if raw, ok := service.Spec.Template.Annotations[key]; ok {
+		return raw, true
+	}
+	raw, ok := service.Annotations[key]
+	return raw, ok
+}
@@ -0,0 +1,149 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	knative "knative.dev/serving/pkg/apis/serving/v1"
+	yaml "sigs.k8s.io/yaml"
+)
+
+// loadServiceFixture reads a KNative service from testdata and caches it as
+// the current service.
+func loadServiceFixture(t *testing.T, name string) knative.Service {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var service knative.Service
+	if err := yaml.Unmarshal(content, &service); err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	ResetCache()
+	t.Cleanup(ResetCache)
+	this.knativeService = &service
+	return service
+}
+
+func TestParseServiceConfig(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected ServiceConfig
+	}{
+		{"service.yaml", ServiceConfig{
+			Creator:                    "alice@example.com",
+			LastModifier:               "bob@example.com",
+			LaunchStage:                "BETA",
+			Description:                "Serves things",
+			Ingress:                    "internal-and-cloud-load-balancing",
+			IngressStatus:              "internal-and-cloud-load-balancing",
+			BinaryAuthorizationPolicy:  "default",
+			ServiceMinimumInstances:    2,
+			InvokerIAMDisabled:         true,
+			RevisionMinimumInstances:   1,
+			RevisionMaximumInstances:   100,
+			StartupCPUBoost:            true,
+			SessionAffinity:            true,
+			CloudSQLInstances:          []string{"my-project:europe-west1:db1", "my-project:europe-west1:db2"},
+			ExecutionEnvironment:       "gen2",
+			VPCAccessEgress:            "all-traffic",
+			VPCNetworkInterfaces:       `[{"network":"default","subnetwork":"default"}]`,
+			EncryptionKey:              "projects/my-project/locations/europe-west1/keyRings/ring/cryptoKeys/key",
+			EncryptionKeyShutdownHours: 3,
+		}},
+		{"service.json", ServiceConfig{
+			LaunchStage:        "GA",
+			Ingress:            "all",
+			CPUThrottling:      true,
+			ScalingMode:        "manual",
+			ManualInstances:    3,
+			FunctionEntryPoint: "HelloWorld",
+			VPCAccessConnector: "projects/my-project/locations/us-central1/connectors/conn",
+			VPCAccessEgress:    "all-traffic",
+			CloudSQLInstances:  []string{"my-project:us-central1:db"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			loadServiceFixture(t, tt.fixture)
+			cfg, err := LoadServiceConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprintf("%+v", cfg) != fmt.Sprintf("%+v", tt.expected) {
+				t.Fatalf("expected\n%+v\ngot\n%+v", tt.expected, cfg)
+			}
+		})
+	}
+}
+
+func TestParseServiceConfigInvalid(t *testing.T) {
+	service := knative.Service{}
+	service.Annotations = map[string]string{"run.googleapis.com/minScale": "many"}
+	service.Spec.Template.Annotations = map[string]string{"run.googleapis.com/startup-cpu-boost": "yes please"}
+
+	_, err := ParseServiceConfig(service)
+	if err == nil {
+		t.Fatal("expected invalid annotations to be reported")
+	}
+	for _, key := range []string{"run.googleapis.com/minScale", "run.googleapis.com/startup-cpu-boost"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected error to report '%s', got %v", key, err)
+		}
+	}
+}
+
+func TestAnnotationAccessors(t *testing.T) {
+	loadServiceFixture(t, "service.yaml")
+
+	tests := []struct {
+		name     string
+		get      func() (any, error)
+		expected any
+		err      string
+	}{
+		{"Creator", func() (any, error) { return Creator() }, "alice@example.com", ""},
+		{"Ingress", func() (any, error) { return Ingress() }, "internal-and-cloud-load-balancing", ""},
+		{"ServiceMinimumInstances", func() (any, error) { return ServiceMinimumInstances() }, 2, ""},
+		{"RevisionMaximumInstances", func() (any, error) { return RevisionMaximumInstances() }, 100, ""},
+		{"CPUThrottling", func() (any, error) { return CPUThrottling() }, false, ""},
+		{"StartupCPUBoost", func() (any, error) { return StartupCPUBoost() }, true, ""},
+		{"SessionAffinity", func() (any, error) { return SessionAffinity() }, "true", ""},
+		{"CloudSQLInstances", func() (any, error) { return CloudSQLInstances() }, []string{"my-project:europe-west1:db1", "my-project:europe-west1:db2"}, ""},
+		{"VPCAccessEgress", func() (any, error) { return VPCAccessEgress() }, "all-traffic", ""},
+		{"ManualInstances", func() (any, error) { return ManualInstances() }, -1, "error reading property 'run.googleapis.com/manualInstanceCount'"},
+		{"Annotation", func() (any, error) { return Annotation[int]("run.googleapis.com/encryption-key-shutdown-hours") }, 3, ""},
+		{"AnnotationInvalid", func() (any, error) { return Annotation[int]("run.googleapis.com/ingress") }, 0, "error parsing property 'run.googleapis.com/ingress': strconv.ParseInt: parsing \"internal-and-cloud-load-balancing\": invalid syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
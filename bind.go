@@ -0,0 +1,215 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	durationType        = reflect.TypeFor[time.Duration]()
+)
+
+type bindTag struct {
+	key      string
+	required bool
+	def      string
+	hasDef   bool
+}
+
+// BindConfig populates the fields of the struct pointed to by target from the
+// global config store, falling back to environment variables. Fields are
+// bound using the `run` struct tag:
+//
+//	type Config struct {
+//		Host    string        `run:"DB_HOST,required"`
+//		Port    int           `run:"DB_PORT,default=5432"`
+//		Timeout time.Duration `run:"DB_TIMEOUT,default=5s"`
+//		Tags    []string      `run:"TAGS,default=a,b"`
+//		Cache   CacheConfig   `run:"CACHE_"`
+//	}
+//
+// The `default` option has to be the last option of a tag, as it consumes
+// the remainder of the tag including commas. Slices are split by commas.
+// Nested structs are bound recursively, using their tag as a prefix for the
+// keys of their fields. Types implementing encoding.TextUnmarshaler are
+// supported. Fields without tag and fields tagged with `-` are skipped.
+//
+// All missing and invalid fields are reported in the returned error rather
+// than failing on the first one.
+func BindConfig(target any) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected non-nil pointer to struct, but got %T", target)
+	}
+	return errors.Join(bindStruct(value.Elem(), "", "")...)
+}
+
+func bindStruct(value reflect.Value, prefix string, path string) []error {
+	var errs []error
+	valueType := value.Type()
+	for i := range valueType.NumField() {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		rawTag, tagged := field.Tag.Lookup("run")
+		if rawTag == "-" {
+			continue
+		}
+		fieldValue := value.Field(i)
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+
+		if isNestedStruct(field.Type) {
+			tag := parseBindTag(rawTag)
+			errs = append(errs, bindStruct(fieldValue, prefix+tag.key, fieldPath)...)
+			continue
+		}
+		if !tagged {
+			continue
+		}
+
+		tag := parseBindTag(rawTag)
+		key := prefix + tag.key
+		raw, ok, err := lookupBindValue(key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config field '%s': failed to resolve key '%s': %w", fieldPath, key, err))
+			continue
+		}
+		if !ok {
+			if tag.hasDef {
+				raw = tag.def
+			} else if tag.required {
+				errs = append(errs, fmt.Errorf("config field '%s': missing required key '%s'", fieldPath, key))
+				continue
+			} else {
+				continue
+			}
+		}
+
+		if err := setBindValue(fieldValue, raw); err != nil {
+			errs = append(errs, fmt.Errorf("config field '%s': invalid value for key '%s': %w", fieldPath, key, err))
+		}
+	}
+	return errs
+}
+
+func parseBindTag(raw string) bindTag {
+	tag := bindTag{}
+	key, options, _ := strings.Cut(raw, ",")
+	tag.key = strings.TrimSpace(key)
+	for options != "" {
+		var option string
+		if strings.HasPrefix(options, "default=") {
+			tag.def = strings.TrimPrefix(options, "default=")
+			tag.hasDef = true
+			break
+		}
+		option, options, _ = strings.Cut(options, ",")
+		if strings.TrimSpace(option) == "required" {
+			tag.required = true
+		}
+	}
+	return tag
+}
+
+// lookupBindValue looks up the key in the global config store and falls back
+// to the environment if the key is absent. Keys whose value fails to resolve,
+// e.g. secret references, are reported as errors.
+func lookupBindValue(key string) (string, bool, error) {
+	if _, err := lookupConfigEntry(key); err == nil {
+		val, err := GetConfig(key)
+		return val, err == nil, err
+	}
+	val, ok := os.LookupEnv(key)
+	return val, ok, nil
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	return !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func setBindValue(value reflect.Value, raw string) error {
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if err := setBindValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(elem)
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		elems := splitList(raw)
+		slice := reflect.MakeSlice(value.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := setBindValue(slice.Index(i), elem); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		value.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return &net.ParseError{Type: "level", Text: string(text)}
+	}
+	return nil
+}
+
+type dbConfig struct {
+	Host    string        `run:"HOST,default=localhost"`
+	Port    int           `run:"PORT,required"`
+	Timeout time.Duration `run:"TIMEOUT,default=5s"`
+}
+
+type appConfig struct {
+	Name     string   `run:"APP_NAME,required"`
+	Debug    bool     `run:"APP_DEBUG"`
+	Tags     []string `run:"APP_TAGS,default=a,b"`
+	Ports    []int    `run:"APP_PORTS"`
+	Level    level    `run:"APP_LEVEL,default=low"`
+	DB       dbConfig `run:"DB_"`
+	Ignored  string   `run:"-"`
+	Untagged string
+}
+
+func TestBindConfig(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("APP_NAME", "svc")
+	PutConfig("APP_PORTS", "80,443")
+	PutConfig("DB_PORT", "5432")
+	t.Setenv("APP_DEBUG", "true")
+	t.Setenv("APP_LEVEL", "high")
+
+	var cfg appConfig
+	if err := BindConfig(&cfg); err != nil {
+		t.Fatalf("failed to bind config: %v", err)
+	}
+
+	if cfg.Name != "svc" || !cfg.Debug || cfg.Level != 2 {
+		t.Fatalf("unexpected scalar fields: %+v", cfg)
+	}
+	if strings.Join(cfg.Tags, "|") != "a|b" || len(cfg.Ports) != 2 || cfg.Ports[1] != 443 {
+		t.Fatalf("unexpected slice fields: %+v", cfg)
+	}
+	if cfg.DB.Host != "localhost" || cfg.DB.Port != 5432 || cfg.DB.Timeout != 5*time.Second {
+		t.Fatalf("unexpected nested fields: %+v", cfg.DB)
+	}
+}
+
+func TestBindConfigAggregatesErrors(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("APP_DEBUG", "maybe")
+	PutConfig("DB_TIMEOUT", "soon")
+
+	var cfg appConfig
+	err := BindConfig(&cfg)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, expected := range []string{"'Name'", "'Debug'", "'DB.Port'", "'DB.Timeout'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to mention field %s, got: %v", expected, err)
+		}
+	}
+
+	if err := BindConfig(cfg); err == nil {
+		t.Fatal("expected error for non-pointer target")
+	}
+}
+
+func TestBindConfigReportsResolutionErrors(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	EnableConfigInterpolation()
+	defer configInterpolation.Store(false)
+
+	t.Setenv("HOST", "from-env")
+	PutConfig("HOST", "${MISSING}")
+	PutConfig("PORT", "${MISSING}")
+
+	var cfg dbConfig
+	err := BindConfig(&cfg)
+	if err == nil {
+		t.Fatal("expected resolution errors")
+	}
+	for _, expected := range []string{
+		"config field 'Host': failed to resolve key 'HOST': failed to interpolate config key 'HOST': unresolved reference '${MISSING}'",
+		"config field 'Port': failed to resolve key 'PORT'",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got: %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "missing required key") {
+		t.Errorf("expected existing key not to be reported missing, got: %v", err)
+	}
+	if cfg.Host != "" {
+		t.Errorf("expected no fallback to environment or default, got %q", cfg.Host)
+	}
+}
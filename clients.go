@@ -13,101 +13,781 @@
 package run
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type lazyClient struct {
-	clientPtr      any
-	lazyInitialize func()
-	clientOnce     *sync.Once
-	initialized    bool
+	name           string
+	typeName       string
+	order          uint64
+	lazyInitialize func(context.Context) (any, error)
+	retryInterval  time.Duration
+	noRetry        bool
+	initTimeout    time.Duration
+	healthCheck    func(context.Context, any) error
+	dependencies   []string
+
+	// initMu serializes initialization attempts.
+	initMu sync.Mutex
+
+	// mu guards the state below.
+	mu           sync.Mutex
+	clientPtr    any
+	initialized  bool
+	initErr      error
+	failedAt     time.Time
+	initDuration time.Duration
+	closed       bool
+	lastHealth   *ClientStatus
+}
+
+// ClientOption configures a client registered with RegisterLazy or
+// LazyClient.
+type ClientOption func(*lazyClient)
+
+// ClientRetryAfter configures a lazy client to retry a failed initialization
+// only once the given interval has passed since the last failure. Until then
+// UseClient returns the last initialization error.
+func ClientRetryAfter(interval time.Duration) ClientOption {
+	return func(lc *lazyClient) {
+		lc.retryInterval = interval
+	}
 }
 
-var clients map[string]*lazyClient
+// ClientNoRetry configures a lazy client to never retry a failed
+// initialization. UseClient keeps returning the initialization error.
+func ClientNoRetry() ClientOption {
+	return func(lc *lazyClient) {
+		lc.noRetry = true
+	}
+}
+
+// ClientInitTimeout configures the timeout of the context passed to the
+// initialization function of a lazy client.
+func ClientInitTimeout(timeout time.Duration) ClientOption {
+	return func(lc *lazyClient) {
+		lc.initTimeout = timeout
+	}
+}
+
+// ClientHealthCheck configures a health check for a client, e.g. pinging a
+// database. The check is executed by CheckClients once the client is
+// initialized.
+func ClientHealthCheck[T any](check func(context.Context, T) error) ClientOption {
+	return func(lc *lazyClient) {
+		lc.healthCheck = func(ctx context.Context, client any) error {
+			typed, ok := client.(T)
+			if !ok {
+				var expected T
+				return fmt.Errorf("health check expects client of type %T, but got %T", expected, client)
+			}
+			return check(ctx, typed)
+		}
+	}
+}
+
+// ClientDependsOn declares the names of clients a client depends on. Lazy
+// dependencies are initialized before the client itself and clients are
+// closed before their dependencies. Dependency cycles are rejected on
+// registration.
+func ClientDependsOn(names ...string) ClientOption {
+	return func(lc *lazyClient) {
+		lc.dependencies = append(lc.dependencies, names...)
+	}
+}
+
+var (
+	clients   = make(map[string]*lazyClient)
+	clientsMu sync.RWMutex
+	// clientsOrder is the sequence number of the last registered client.
+	clientsOrder uint64
+)
 
 // ResetClients deletes all previously configured clients.
 func ResetClients() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 	clients = make(map[string]*lazyClient)
 }
 
 // CountClients returns number of stored clients.
 func CountClients() int {
-	ensureInitClients()
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
 	return len(clients)
 }
 
-// Client registers an already initialized client.
-func Client(name string, client any) {
-	ensureInitClients()
-	clients[name] = &lazyClient{
-		client,
-		nil,
-		&sync.Once{},
-		true,
+// DeleteClient removes the client with the given name from the global clients
+// store. The client itself is not closed.
+func DeleteClient(name string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	delete(clients, name)
+}
+
+// Client registers an already initialized client. If a lazy client with the
+// same name is registered, it is marked as initialized with the supplied
+// client. Registrations introducing a dependency cycle are logged and leave
+// the registered client unchanged.
+func Client(name string, client any, opts ...ClientOption) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if lc, ok := clients[name]; ok {
+		candidate := &lazyClient{dependencies: slices.Clone(lc.dependencies)}
+		for _, opt := range opts {
+			opt(candidate)
+		}
+		if err := checkDependencyCycle(name, candidate.dependencies); err != nil {
+			Error(nil, err)
+			return
+		}
+		for _, opt := range opts {
+			opt(lc)
+		}
+		lc.mu.Lock()
+		lc.clientPtr = client
+		lc.initialized = true
+		lc.initErr = nil
+		lc.mu.Unlock()
+		return
+	}
+	lc := &lazyClient{
+		name:        name,
+		clientPtr:   client,
+		initialized: true,
+	}
+	for _, opt := range opts {
+		opt(lc)
+	}
+	if err := addClient(lc); err != nil {
+		Error(nil, err)
 	}
 }
 
 // LazyClient registers an uninitialized client name with an initialization
 // function. The init func should call Client() with the initialized client.
-func LazyClient(name string, init func()) {
-	ensureInitClients()
-	clients[name] = &lazyClient{
-		nil,
-		init,
-		&sync.Once{},
-		false,
+//
+// Prefer RegisterLazy, which surfaces initialization errors through
+// UseClient and registration errors like dependency cycles to the caller.
+// LazyClient only logs registration errors.
+func LazyClient(name string, init func(), opts ...ClientOption) {
+	err := registerLazy(name, func(context.Context) (any, error) {
+		init()
+		lc, ok := lookupClient(name)
+		if !ok {
+			return nil, fmt.Errorf("no client found for name: '%s'", name)
+		}
+		lc.mu.Lock()
+		defer lc.mu.Unlock()
+		if !lc.initialized {
+			return nil, fmt.Errorf("lazy init of client '%s' did not call Client()", name)
+		}
+		return lc.clientPtr, nil
+	}, opts...)
+	if err != nil {
+		Error(nil, err)
+	}
+}
+
+// RegisterLazy registers an uninitialized client name with a typed
+// initialization function, which is executed on first use of the client.
+//
+// If the initialization fails, the error is returned from UseClient. Failed
+// initializations are retried on the next use of the client unless configured
+// otherwise with ClientRetryAfter or ClientNoRetry.
+func RegisterLazy[T any](name string, init func(context.Context) (T, error), opts ...ClientOption) error {
+	if name == "" {
+		return errors.New("cannot register client without name")
+	}
+	if init == nil {
+		return fmt.Errorf("cannot register client '%s' without init func", name)
+	}
+	opts = append([]ClientOption{clientType[T]()}, opts...)
+	return registerLazy(name, func(ctx context.Context) (any, error) {
+		return init(ctx)
+	}, opts...)
+}
+
+// clientType records the declared type of a lazy client before it is
+// initialized.
+func clientType[T any]() ClientOption {
+	return func(lc *lazyClient) {
+		lc.typeName = reflect.TypeFor[T]().String()
+	}
+}
+
+func registerLazy(name string, init func(context.Context) (any, error), opts ...ClientOption) error {
+	lc := &lazyClient{
+		name:           name,
+		lazyInitialize: init,
+	}
+	for _, opt := range opts {
+		opt(lc)
+	}
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	return addClient(lc)
+}
+
+// addClient stores the client in the global clients store unless its
+// dependencies introduce a cycle. Requires clientsMu to be held.
+func addClient(lc *lazyClient) error {
+	if err := checkDependencyCycle(lc.name, lc.dependencies); err != nil {
+		return err
+	}
+	clientsOrder++
+	lc.order = clientsOrder
+	clients[lc.name] = lc
+	return nil
+}
+
+// checkDependencyCycle reports an error if registering a client with the
+// given name and dependencies introduces a dependency cycle. Requires
+// clientsMu to be held.
+func checkDependencyCycle(name string, dependencies []string) error {
+	var visit func(path []string, deps []string) []string
+	visit = func(path []string, deps []string) []string {
+		for _, dep := range deps {
+			if dep == name {
+				return append(slices.Clone(path), dep)
+			}
+			if slices.Contains(path, dep) {
+				continue
+			}
+			lc, ok := clients[dep]
+			if !ok {
+				continue
+			}
+			if cycle := visit(append(slices.Clone(path), dep), lc.dependencies); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
 	}
+
+	if cycle := visit([]string{name}, dependencies); cycle != nil {
+		return fmt.Errorf(
+			"cannot register client '%s', dependency cycle detected: %s",
+			name,
+			strings.Join(cycle, " -> "),
+		)
+	}
+	return nil
+}
+
+func lookupClient(name string) (*lazyClient, bool) {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	lc, ok := clients[name]
+	return lc, ok
 }
 
 // UseClient is intended to retrieve a pointer to a client for a given key name.
 // It requires the name of a stored client and a nil pointer of it's type.
-// NOTE: maybe this shouldn't return T, just error...
+//
+// Lazy clients are initialized on first use. If the initialization fails, its
+// error is returned.
 func UseClient[T any](name string, client T) (T, error) {
-	ensureInitClients()
 	// Check if client is a pointer
 	if !isPointer(client) {
 		return client, fmt.Errorf("expected pointer to client, but got %T", client)
 	}
 
+	stored, err := useClient(context.Background(), name)
+	if err != nil {
+		return client, err
+	}
+
+	// Cast to actual expected type
+	actual, ok := stored.(T)
+	if !ok {
+		return client, fmt.Errorf(
+			"failed to cast stored client '%s' of type %T to requested type: %T",
+			name,
+			stored,
+			client,
+		)
+	}
+
+	return actual, nil
+}
+
+// ClientKey is a typed handle for a client in the global clients store. It
+// binds the name of a client to its type, so that mismatches are caught at
+// compile time.
+//
+//	var BQ = run.NewClientKey[*bigquery.Client]("bigquery")
+type ClientKey[T any] struct {
+	name string
+}
+
+// NewClientKey returns a typed handle for the client with the given name.
+func NewClientKey[T any](name string) ClientKey[T] {
+	return ClientKey[T]{name}
+}
+
+// Name returns the name of the client in the global clients store.
+func (k ClientKey[T]) Name() string {
+	return k.name
+}
+
+// Get retrieves the client and initializes it with the supplied context if
+// required.
+func (k ClientKey[T]) Get(ctx context.Context) (T, error) {
+	var client T
+	stored, err := useClient(ctx, k.name)
+	if err != nil {
+		return client, err
+	}
+	client, ok := stored.(T)
+	if !ok {
+		return client, fmt.Errorf(
+			"failed to cast stored client '%s' of type %T to requested type: %T",
+			k.name,
+			stored,
+			client,
+		)
+	}
+	return client, nil
+}
+
+// Set registers an already initialized client, see Client.
+func (k ClientKey[T]) Set(client T, opts ...ClientOption) {
+	Client(k.name, client, opts...)
+}
+
+// Lazy registers a client with an initialization function, see RegisterLazy.
+func (k ClientKey[T]) Lazy(init func(context.Context) (T, error), opts ...ClientOption) error {
+	return RegisterLazy(k.name, init, opts...)
+}
+
+// useClient returns the client stored for the name and initializes it if
+// required.
+func useClient(ctx context.Context, name string) (any, error) {
 	// Check if client is known
-	lc, ok := clients[name]
+	lc, ok := lookupClient(name)
 	if !ok {
-		return client, fmt.Errorf("no client found for name: '%s'", name)
+		return nil, fmt.Errorf("no client found for name: '%s'", name)
+	}
+
+	client, err := lc.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isNil(client) {
+		return nil, fmt.Errorf("client '%s' is nil", name)
 	}
+	return client, nil
+}
 
-	// check if it can be initialized
-	if !lc.initialized && lc.lazyInitialize == nil {
-		return client, fmt.Errorf("cannot initialize client '%s'", name)
+// get returns the client and initializes it if required. Only one
+// initialization attempt is in flight at any time.
+func (lc *lazyClient) get(ctx context.Context) (any, error) {
+	if client, err, done := lc.state(); done {
+		return client, err
 	}
 
-	// Synced initialization once
-	if lc.lazyInitialize != nil {
-		lc.clientOnce.Do(lc.lazyInitialize)
+	// Dependencies first
+	for _, dep := range lc.dependencies {
+		if _, err := useClient(ctx, dep); err != nil {
+			return nil, fmt.Errorf(
+				"failed to initialize dependency '%s' of client '%s': %w",
+				dep,
+				lc.name,
+				err,
+			)
+		}
 	}
 
-	// Refresh
-	lc, ok = clients[name]
-	if !ok {
-		return client, fmt.Errorf("no client found for name: '%s'", name)
+	lc.initMu.Lock()
+	defer lc.initMu.Unlock()
+
+	// Another caller might have finished initialization in the meantime
+	if client, err, done := lc.state(); done {
+		return client, err
 	}
 
-	// Cast to actual expected type
-	actual, ok := lc.clientPtr.(T)
-	if !ok {
-		return client, fmt.Errorf("failed to cast stored client to requested type: %T", actual)
+	if lc.initTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lc.initTimeout)
+		defer cancel()
 	}
 
-	client = actual
-	return actual, nil
+	start := time.Now()
+	client, err := lc.lazyInitialize(ctx)
+	if err == nil && isNil(client) {
+		err = errors.New("init func returned nil client")
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.initDuration = time.Since(start)
+	if err != nil {
+		// Discard whatever Client() stored during the failed initialization
+		lc.clientPtr = nil
+		lc.initialized = false
+		lc.initErr = fmt.Errorf("failed to initialize client '%s': %w", lc.name, err)
+		lc.failedAt = time.Now()
+		return nil, lc.initErr
+	}
+	lc.clientPtr = client
+	lc.initialized = true
+	lc.initErr = nil
+	return client, nil
+}
+
+// state returns the client or the error preventing its initialization. done
+// is false if an initialization attempt is required.
+func (lc *lazyClient) state() (client any, err error, done bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.initialized {
+		return lc.clientPtr, nil, true
+	}
+	if lc.lazyInitialize == nil {
+		return nil, fmt.Errorf("cannot initialize client '%s'", lc.name), true
+	}
+	if lc.initErr != nil && (lc.noRetry || time.Since(lc.failedAt) < lc.retryInterval) {
+		return nil, lc.initErr, true
+	}
+	return nil, nil, false
+}
+
+// ClientWarmup reports the result of the initialization of a single client by
+// WarmClients.
+type ClientWarmup struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// WarmClients concurrently initializes the named lazy clients, or all
+// registered lazy clients if no names are supplied. Clients which are already
+// initialized are skipped.
+//
+// Each initialization respects the timeout configured with ClientInitTimeout
+// and the deadline of the context, whichever is shorter. Initialization
+// functions which ignore their context are abandoned once the deadline
+// expires. The returned report lists how long each client took to initialize.
+func WarmClients(ctx context.Context, names ...string) ([]ClientWarmup, error) {
+	if len(names) == 0 {
+		names = ListClientNames()
+	}
+
+	report := make([]ClientWarmup, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		report[i].Name = name
+		lc, ok := lookupClient(name)
+		if !ok {
+			report[i].Err = fmt.Errorf("no client found for name: '%s'", name)
+			continue
+		}
+		if _, err, done := lc.state(); done {
+			report[i].Err = err
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			initCtx := ctx
+			if lc.initTimeout > 0 {
+				var cancel context.CancelFunc
+				initCtx, cancel = context.WithTimeout(ctx, lc.initTimeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			done := make(chan error, 1)
+			go func() {
+				_, err := lc.get(initCtx)
+				done <- err
+			}()
+
+			select {
+			case err := <-done:
+				report[i].Err = err
+			case <-initCtx.Done():
+				report[i].Err = fmt.Errorf("failed to initialize client '%s': %w", name, initCtx.Err())
+			}
+			report[i].Duration = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, warmup := range report {
+		if warmup.Err != nil {
+			errs = append(errs, warmup.Err)
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// ClientStatus reports the health of a single client as determined by
+// CheckClients.
+type ClientStatus struct {
+	Name string
+	// Initialized is false for lazy clients which were not used yet. Those are
+	// not checked and considered healthy, unless their last initialization
+	// failed.
+	Initialized bool
+	Healthy     bool
+	Err         error
+	Latency     time.Duration
+	CheckedAt   time.Time
+}
+
+// CheckClients concurrently executes the health checks of all initialized
+// clients configured with ClientHealthCheck and returns the status of every
+// registered client sorted by name. Clients without health check are
+// considered healthy. Lazy clients whose last initialization failed are
+// reported unhealthy with the initialization error.
+func CheckClients(ctx context.Context) []ClientStatus {
+	names := ListClientNames()
+	statuses := make([]ClientStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		statuses[i] = ClientStatus{Name: name, Healthy: true}
+		lc, ok := lookupClient(name)
+		if !ok {
+			continue
+		}
+
+		lc.mu.Lock()
+		client := lc.clientPtr
+		statuses[i].Initialized = lc.initialized
+		initErr := lc.initErr
+		lc.mu.Unlock()
+		if !statuses[i].Initialized && initErr != nil {
+			statuses[i].Healthy = false
+			statuses[i].Err = initErr
+			continue
+		}
+		if !statuses[i].Initialized || lc.healthCheck == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := lc.healthCheck(ctx, client)
+			status := &statuses[i]
+			status.CheckedAt = start
+			status.Latency = time.Since(start)
+			if err != nil {
+				status.Healthy = false
+				status.Err = fmt.Errorf("health check of client '%s' failed: %w", name, err)
+			}
+
+			lc.mu.Lock()
+			last := *status
+			lc.lastHealth = &last
+			lc.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// ClientInfo describes a registered client for debugging purposes.
+type ClientInfo struct {
+	Name         string        `json:"name"`
+	Type         string        `json:"type,omitempty"`
+	Lazy         bool          `json:"lazy"`
+	Initialized  bool          `json:"initialized"`
+	InitDuration time.Duration `json:"initDuration,omitempty"`
+	InitError    string        `json:"initError,omitempty"`
+	Dependencies []string      `json:"dependencies,omitempty"`
+	// LastHealth is the result of the last health check executed by
+	// CheckClients, if any.
+	LastHealth *ClientHealth `json:"lastHealth,omitempty"`
+}
+
+// ClientHealth is the serializable result of a client health check.
+type ClientHealth struct {
+	Healthy   bool          `json:"healthy"`
+	Error     string        `json:"error,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// DescribeClients returns information on all registered clients sorted by
+// name. It does not initialize lazy clients nor execute health checks.
+func DescribeClients() []ClientInfo {
+	names := ListClientNames()
+	infos := make([]ClientInfo, 0, len(names))
+	for _, name := range names {
+		lc, ok := lookupClient(name)
+		if !ok {
+			continue
+		}
+
+		lc.mu.Lock()
+		info := ClientInfo{
+			Name:         name,
+			Type:         lc.typeName,
+			Lazy:         lc.lazyInitialize != nil,
+			Initialized:  lc.initialized,
+			InitDuration: lc.initDuration,
+			Dependencies: slices.Clone(lc.dependencies),
+		}
+		if lc.initialized && !isNil(lc.clientPtr) {
+			info.Type = fmt.Sprintf("%T", lc.clientPtr)
+		}
+		if lc.initErr != nil {
+			info.InitError = lc.initErr.Error()
+		}
+		if lc.lastHealth != nil {
+			info.LastHealth = &ClientHealth{
+				Healthy:   lc.lastHealth.Healthy,
+				Latency:   lc.lastHealth.Latency,
+				CheckedAt: lc.lastHealth.CheckedAt,
+			}
+			if lc.lastHealth.Err != nil {
+				info.LastHealth.Error = lc.lastHealth.Err.Error()
+			}
+		}
+		lc.mu.Unlock()
+
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// ClientsHealthy reports whether all clients passed their health checks and
+// returns the errors of failed checks joined.
+func ClientsHealthy(ctx context.Context) (bool, error) {
+	var errs []error
+	for _, status := range CheckClients(ctx) {
+		if !status.Healthy {
+			errs = append(errs, status.Err)
+		}
+	}
+	return len(errs) == 0, errors.Join(errs...)
+}
+
+// CloseClients closes all initialized clients in reverse registration order,
+// where clients are always closed before their dependencies. Clients are
+// closed if they implement io.Closer or a `Close()` method without
+// return value. Lazy clients which were never initialized are skipped.
+//
+// Errors are logged per client and returned joined. If the context expires,
+// remaining clients are not closed.
+//
+// CloseClients is executed as part of Shutdown.
+func CloseClients(ctx context.Context) error {
+	clientsMu.RLock()
+	registered := make([]*lazyClient, 0, len(clients))
+	for _, lc := range clients {
+		registered = append(registered, lc)
+	}
+	clientsMu.RUnlock()
+
+	var errs []error
+	for _, lc := range slices.Backward(dependencyOrder(registered)) {
+		lc.mu.Lock()
+		client := lc.clientPtr
+		skip := !lc.initialized || lc.closed || isNil(client)
+		if !skip {
+			lc.closed = true
+		}
+		lc.mu.Unlock()
+		if skip {
+			continue
+		}
+
+		if err := closeClient(ctx, client); err != nil {
+			err = fmt.Errorf("failed to close client '%s': %w", lc.name, err)
+			Error(nil, err)
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		Debugf(nil, "closed client '%s'", lc.name)
+	}
+	return errors.Join(errs...)
+}
+
+// dependencyOrder sorts the clients in registration order such that every
+// client is placed after its dependencies.
+func dependencyOrder(registered []*lazyClient) []*lazyClient {
+	slices.SortFunc(registered, func(a, b *lazyClient) int {
+		return cmp.Compare(a.order, b.order)
+	})
+	byName := make(map[string]*lazyClient, len(registered))
+	for _, lc := range registered {
+		byName[lc.name] = lc
+	}
+
+	ordered := make([]*lazyClient, 0, len(registered))
+	visited := make(map[string]bool, len(registered))
+	var visit func(lc *lazyClient)
+	visit = func(lc *lazyClient) {
+		if visited[lc.name] {
+			return
+		}
+		visited[lc.name] = true
+		for _, dep := range lc.dependencies {
+			if depClient, ok := byName[dep]; ok {
+				visit(depClient)
+			}
+		}
+		ordered = append(ordered, lc)
+	}
+	for _, lc := range registered {
+		visit(lc)
+	}
+	return ordered
+}
+
+// closeClient closes the client if it is closable. It waits for the close to
+// complete or the context to expire, whatever happens first.
+func closeClient(ctx context.Context, client any) error {
+	var closeFunc func() error
+	switch c := client.(type) {
+	case io.Closer:
+		closeFunc = c.Close
+	case interface{ Close() }:
+		closeFunc = func() error {
+			c.Close()
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- closeFunc()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // ListClientNames returns a list of all available keys store in the global
 // clients store.
 func ListClientNames() []string {
-	ensureInitClients()
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
 	names := make([]string, 0, len(clients))
 	for name := range clients {
 		names = append(names, name)
@@ -116,12 +796,18 @@ func ListClientNames() []string {
 	return names
 }
 
-func ensureInitClients() {
-	if clients == nil {
-		ResetClients()
-	}
-}
-
 func isPointer(a any) bool {
 	return reflect.ValueOf(a).Kind() == reflect.Ptr
 }
+
+func isNil(a any) bool {
+	if a == nil {
+		return true
+	}
+	value := reflect.ValueOf(a)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,569 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	id int64
+}
+
+const contention = 100
+
+func TestRegisterLazyContention(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var inits atomic.Int64
+	err := RegisterLazy("test", func(context.Context) (*testClient, error) {
+		time.Sleep(10 * time.Millisecond) // Widen the race window
+		return &testClient{inits.Add(1)}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	results := make(chan *testClient, contention)
+	var wg sync.WaitGroup
+	for range contention {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var client *testClient
+			client, err := UseClient("test", client)
+			if err != nil {
+				t.Errorf("failed to use client: %v", err)
+				return
+			}
+			results <- client
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	if got := inits.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 initialization, got %d", got)
+	}
+	for client := range results {
+		if client.id != 1 {
+			t.Fatalf("expected client from first initialization, got %d", client.id)
+		}
+	}
+}
+
+func TestLazyClientContention(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var inits atomic.Int64
+	LazyClient("test", func() {
+		time.Sleep(10 * time.Millisecond) // Widen the race window
+		Client("test", &testClient{inits.Add(1)})
+	})
+
+	var wg sync.WaitGroup
+	for range contention {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var client *testClient
+			client, err := UseClient("test", client)
+			if err != nil {
+				t.Errorf("failed to use client: %v", err)
+				return
+			}
+			if client.id != 1 {
+				t.Errorf("expected client from first initialization, got %d", client.id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := inits.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 initialization, got %d", got)
+	}
+}
+
+func TestRegisterLazyRetryContention(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var inits atomic.Int64
+	err := RegisterLazy("test", func(context.Context) (*testClient, error) {
+		if inits.Add(1) == 1 {
+			return nil, errors.New("transient failure")
+		}
+		return &testClient{}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	var failures atomic.Int64
+	var wg sync.WaitGroup
+	for range contention {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var client *testClient
+			if _, err := UseClient("test", client); err != nil {
+				failures.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := failures.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 failed use, got %d", got)
+	}
+	if got := inits.Load(); got != 2 {
+		t.Fatalf("expected exactly 2 initializations, got %d", got)
+	}
+}
+
+func TestRegisterLazyNoRetry(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var inits atomic.Int64
+	err := RegisterLazy("test", func(context.Context) (*testClient, error) {
+		inits.Add(1)
+		return nil, errors.New("permanent failure")
+	}, ClientNoRetry())
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range contention {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var client *testClient
+			if _, err := UseClient("test", client); err == nil {
+				t.Error("expected initialization error")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := inits.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 initialization, got %d", got)
+	}
+}
+
+func TestRegisterLazyRetryAfter(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	failure := errors.New("transient failure")
+	var inits atomic.Int64
+	err := RegisterLazy("test", func(context.Context) (*testClient, error) {
+		if inits.Add(1) == 1 {
+			return nil, failure
+		}
+		return &testClient{}, nil
+	}, ClientRetryAfter(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	var client *testClient
+	for range 3 {
+		if _, err := UseClient("test", client); !errors.Is(err, failure) {
+			t.Fatalf("expected initialization error, got %v", err)
+		}
+	}
+	if got := inits.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 initialization within the retry interval, got %d", got)
+	}
+
+	// Pretend the retry interval has passed.
+	lc, _ := lookupClient("test")
+	lc.mu.Lock()
+	lc.failedAt = time.Now().Add(-time.Hour)
+	lc.mu.Unlock()
+
+	if _, err := UseClient("test", client); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if got := inits.Load(); got != 2 {
+		t.Fatalf("expected exactly 2 initializations, got %d", got)
+	}
+}
+
+func TestRegisterLazyRetryOnNextUse(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var inits atomic.Int64
+	err := RegisterLazy("test", func(context.Context) (*testClient, error) {
+		if inits.Add(1) < 3 {
+			return nil, errors.New("transient failure")
+		}
+		return &testClient{}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	var client *testClient
+	for i := range 2 {
+		if _, err := UseClient("test", client); err == nil {
+			t.Fatalf("expected initialization error on use %d", i+1)
+		}
+	}
+	if _, err := UseClient("test", client); err != nil {
+		t.Fatalf("expected third use to succeed, got %v", err)
+	}
+	if _, err := UseClient("test", client); err != nil {
+		t.Fatalf("expected initialized client, got %v", err)
+	}
+	if got := inits.Load(); got != 3 {
+		t.Fatalf("expected exactly 3 initializations, got %d", got)
+	}
+}
+
+func TestClientRegistryConcurrentAccess(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	var wg sync.WaitGroup
+	for i := range contention {
+		name := fmt.Sprintf("client-%d", i%10)
+		wg.Add(6)
+		go func() {
+			defer wg.Done()
+			Client(name, &testClient{})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = RegisterLazy(name, func(context.Context) (*testClient, error) {
+				return &testClient{}, nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			var client *testClient
+			_, _ = UseClient(name, client)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = ListClientNames()
+			_ = CountClients()
+		}()
+		go func() {
+			defer wg.Done()
+			DeleteClient(name)
+		}()
+		go func() {
+			defer wg.Done()
+			if i%25 == 0 {
+				ResetClients()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := CountClients(); got > 10 {
+		t.Fatalf("expected at most 10 clients, got %d", got)
+	}
+}
+
+type closableClient struct {
+	name   string
+	closed *[]string
+}
+
+func (c *closableClient) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return nil
+}
+
+func TestCloseClientsReverseOrder(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	closed := []string{}
+	Client("first", &closableClient{"first", &closed})
+	_ = RegisterLazy("lazy", func(context.Context) (*closableClient, error) {
+		return &closableClient{"lazy", &closed}, nil
+	})
+	_ = RegisterLazy("never", func(context.Context) (*closableClient, error) {
+		return &closableClient{"never", &closed}, nil
+	})
+	Client("last", &closableClient{"last", &closed})
+
+	var client *closableClient
+	if _, err := UseClient("lazy", client); err != nil {
+		t.Fatalf("failed to use client: %v", err)
+	}
+
+	if err := CloseClients(context.Background()); err != nil {
+		t.Fatalf("failed to close clients: %v", err)
+	}
+	if err := CloseClients(context.Background()); err != nil {
+		t.Fatalf("failed to close clients twice: %v", err)
+	}
+
+	expected := []string{"last", "lazy", "first"}
+	if fmt.Sprint(closed) != fmt.Sprint(expected) {
+		t.Fatalf("expected clients to be closed in order %v, got %v", expected, closed)
+	}
+}
+
+func TestCloseClientsInitializedLater(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	closed := []string{}
+	_ = RegisterLazy("lazy", func(context.Context) (*closableClient, error) {
+		return &closableClient{"lazy", &closed}, nil
+	})
+	if err := CloseClients(context.Background()); err != nil {
+		t.Fatalf("failed to close clients: %v", err)
+	}
+
+	var client *closableClient
+	if _, err := UseClient("lazy", client); err != nil {
+		t.Fatalf("failed to use client: %v", err)
+	}
+	if err := CloseClients(context.Background()); err != nil {
+		t.Fatalf("failed to close clients: %v", err)
+	}
+	if fmt.Sprint(closed) != "[lazy]" {
+		t.Fatalf("expected client initialized after the first close to be closed, got %v", closed)
+	}
+}
+
+func TestWarmClients(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	_ = RegisterLazy("fast", func(context.Context) (*testClient, error) {
+		return &testClient{}, nil
+	})
+	_ = RegisterLazy("slow", func(context.Context) (*testClient, error) {
+		time.Sleep(time.Second) // Ignores the context
+		return &testClient{}, nil
+	}, ClientInitTimeout(50*time.Millisecond))
+	Client("eager", &testClient{})
+
+	start := time.Now()
+	report, err := WarmClients(context.Background())
+	if err == nil {
+		t.Fatal("expected timeout error for slow client")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected warm up to be abandoned after timeout, took %s", elapsed)
+	}
+
+	results := map[string]error{}
+	for _, warmup := range report {
+		results[warmup.Name] = warmup.Err
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected report for 3 clients, got %v", report)
+	}
+	if results["fast"] != nil || results["eager"] != nil {
+		t.Fatalf("expected fast and eager clients to succeed, got %v", report)
+	}
+	if !errors.Is(results["slow"], context.DeadlineExceeded) {
+		t.Fatalf("expected slow client to exceed deadline, got %v", results["slow"])
+	}
+}
+
+func TestCheckClients(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	Client("healthy", &testClient{}, ClientHealthCheck(func(context.Context, *testClient) error {
+		return nil
+	}))
+	Client("broken", &testClient{}, ClientHealthCheck(func(context.Context, *testClient) error {
+		return errors.New("connection refused")
+	}))
+	_ = RegisterLazy("lazy", func(context.Context) (*testClient, error) {
+		return &testClient{}, nil
+	}, ClientHealthCheck(func(context.Context, *testClient) error {
+		return errors.New("should not be checked")
+	}))
+
+	statuses := CheckClients(context.Background())
+	if len(statuses) != 3 {
+		t.Fatalf("expected status for 3 clients, got %v", statuses)
+	}
+	for _, status := range statuses {
+		switch status.Name {
+		case "broken":
+			if status.Healthy || status.Err == nil {
+				t.Errorf("expected broken client to be unhealthy, got %+v", status)
+			}
+		case "lazy":
+			if status.Initialized || !status.Healthy {
+				t.Errorf("expected uninitialized lazy client to be skipped, got %+v", status)
+			}
+		default:
+			if !status.Healthy {
+				t.Errorf("expected client to be healthy, got %+v", status)
+			}
+		}
+	}
+
+	if healthy, _ := ClientsHealthy(context.Background()); healthy {
+		t.Fatal("expected clients to be reported unhealthy")
+	}
+}
+
+func TestCheckClientsFailedInitialization(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	_ = RegisterLazy("broken", func(context.Context) (*testClient, error) {
+		return nil, errors.New("permission denied")
+	}, ClientNoRetry())
+
+	var client *testClient
+	if _, err := UseClient("broken", client); err == nil {
+		t.Fatal("expected initialization error")
+	}
+
+	statuses := CheckClients(context.Background())
+	if len(statuses) != 1 {
+		t.Fatalf("expected status for 1 client, got %v", statuses)
+	}
+	status := statuses[0]
+	if status.Initialized || status.Healthy || status.Err == nil {
+		t.Fatalf("expected failed client to be unhealthy, got %+v", status)
+	}
+	if !strings.Contains(status.Err.Error(), "permission denied") {
+		t.Fatalf("expected initialization error, got %v", status.Err)
+	}
+	if healthy, _ := ClientsHealthy(context.Background()); healthy {
+		t.Fatal("expected clients to be reported unhealthy")
+	}
+}
+
+func TestClientDependencies(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	initialized := []string{}
+	closed := []string{}
+	register := func(name string, deps ...string) error {
+		return RegisterLazy(name, func(context.Context) (*closableClient, error) {
+			initialized = append(initialized, name)
+			return &closableClient{name, &closed}, nil
+		}, ClientDependsOn(deps...))
+	}
+
+	// Registered before its dependencies
+	if err := register("repository", "spanner"); err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+	if err := register("spanner", "token"); err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+	if err := register("token"); err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	err := register("token", "repository")
+	if err == nil {
+		t.Fatal("expected dependency cycle to be rejected")
+	}
+	expectedErr := "cannot register client 'token', dependency cycle detected: token -> repository -> spanner -> token"
+	if err.Error() != expectedErr {
+		t.Fatalf("expected error %q, got %q", expectedErr, err)
+	}
+
+	var client *closableClient
+	if _, err := UseClient("repository", client); err != nil {
+		t.Fatalf("failed to use client: %v", err)
+	}
+	expected := []string{"token", "spanner", "repository"}
+	if fmt.Sprint(initialized) != fmt.Sprint(expected) {
+		t.Fatalf("expected initialization order %v, got %v", expected, initialized)
+	}
+
+	if err := CloseClients(context.Background()); err != nil {
+		t.Fatalf("failed to close clients: %v", err)
+	}
+	expected = []string{"repository", "spanner", "token"}
+	if fmt.Sprint(closed) != fmt.Sprint(expected) {
+		t.Fatalf("expected close order %v, got %v", expected, closed)
+	}
+}
+
+func TestClientRejectedCycleKeepsClient(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	original := &testClient{}
+	Client("a", original)
+	Client("b", &testClient{}, ClientDependsOn("a"))
+	Client("a", &testClient{}, ClientDependsOn("b"))
+
+	var client *testClient
+	got, err := UseClient("a", client)
+	if err != nil {
+		t.Fatalf("failed to use client: %v", err)
+	}
+	if got != original {
+		t.Fatal("expected registration with dependency cycle not to replace the client")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	ResetClients()
+	defer ResetClients()
+
+	key := NewClientKey[*testClient]("test")
+	err := key.Lazy(func(context.Context) (*testClient, error) {
+		return &testClient{42}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to register client: %v", err)
+	}
+
+	client, err := key.Get(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	if client.id != 42 {
+		t.Fatalf("expected client 42, got %d", client.id)
+	}
+
+	key.Set(&testClient{7})
+	var legacy *testClient
+	legacy, err = UseClient(key.Name(), legacy)
+	if err != nil {
+		t.Fatalf("failed to use client: %v", err)
+	}
+	if legacy.id != 7 {
+		t.Fatalf("expected client 7, got %d", legacy.id)
+	}
+
+	if _, err := NewClientKey[*closableClient]("test").Get(context.Background()); err == nil {
+		t.Fatal("expected type mismatch error")
+	}
+}
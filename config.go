@@ -13,60 +13,354 @@
 package run
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var config map[string]string
+const (
+	// configSourceMemory is the source of values stored with PutConfig.
+	configSourceMemory = "memory"
+	// configSourceEnv is the source of values loaded from environment
+	// variables.
+	configSourceEnv = "env"
+)
+
+// redactedConfigValue replaces the values of secret config in listings and
+// logs.
+const redactedConfigValue = "[REDACTED]"
+
+type configEntry struct {
+	value  string
+	source string
+	secret bool
+}
+
+// The global config store is guarded by configMu. Writers additionally hold
+// configWriteMu, see swapConfig.
+var (
+	config   = make(map[string]configEntry)
+	configMu sync.RWMutex
+)
 
 // ResetConfig deletes all previously configured config.
 func ResetConfig() {
-	config = make(map[string]string)
+	configWriteMu.Lock()
+	configMu.Lock()
+	old := config
+	config = make(map[string]configEntry)
+	configMu.Unlock()
+	queueConfigChanges(old, nil)
+	configWriteMu.Unlock()
+
+	notifyConfigWatchers()
 }
 
 // CountConfig returns number of stored config elements.
 func CountConfig() int {
+	configMu.RLock()
+	defer configMu.RUnlock()
 	return len(config)
 }
 
 // PutConfig adds a K/V pair to the global config store.
 func PutConfig(key string, val string) {
-	ensureInitConfig()
-	config[key] = val
+	putConfig(key, val, configSourceMemory)
+}
+
+func putConfig(key string, val string, source string) {
+	storeConfig(map[string]configEntry{key: {value: val, source: source}})
+}
+
+// storeConfig adds all entries to the global config store at once and
+// notifies subscribers of changed keys.
+func storeConfig(entries map[string]configEntry) {
+	configWriteMu.Lock()
+	configMu.Lock()
+	old := make(map[string]configEntry, len(entries))
+	for key, entry := range entries {
+		old[key] = config[key]
+		config[key] = entry
+	}
+	configMu.Unlock()
+	queueConfigChanges(old, entries)
+	configWriteMu.Unlock()
+
+	notifyConfigWatchers()
+}
+
+// DeleteConfig removes the key from the global config store and notifies
+// subscribers of the key.
+func DeleteConfig(key string) {
+	configWriteMu.Lock()
+	configMu.Lock()
+	old := config[key]
+	delete(config, key)
+	configMu.Unlock()
+	queueConfigChanges(map[string]configEntry{key: old}, nil)
+	configWriteMu.Unlock()
+
+	notifyConfigWatchers()
+}
+
+// MarkConfigSecret marks the value of an existing key in the global config
+// store as secret, which redacts it from listings and logs.
+func MarkConfigSecret(key string) error {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+	configMu.Lock()
+	defer configMu.Unlock()
+	entry, ok := config[key]
+	if !ok {
+		return fmt.Errorf("no config found for key: '%s'", key)
+	}
+	entry.secret = true
+	config[key] = entry
+	return nil
+}
+
+// IsSecretConfig reports whether the value for the key is marked as secret.
+func IsSecretConfig(key string) bool {
+	entry, err := lookupConfigEntry(key)
+	return err == nil && (entry.secret || isSecretReference(entry.value))
+}
+
+// ListConfig returns a copy of the global config store in which the values
+// of secret keys are redacted. It is intended for debugging purposes.
+func ListConfig() map[string]string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	listing := make(map[string]string, len(config))
+	for key, entry := range config {
+		listing[key] = entry.redacted()
+	}
+	return listing
+}
+
+func (entry configEntry) redacted() string {
+	if entry.secret {
+		return redactedConfigValue
+	}
+	return entry.value
 }
 
 // GetConfig retrieves a value for a key from the global config store.
+//
+// If enabled with EnableConfigInterpolation, values may reference other keys
+// and built-in runtime values, e.g. `${PROJECT_ID}-uploads-${REGION}`.
+// `${KEY:-fallback}` uses the fallback if the key is missing or empty and
+// `$$` yields a literal `$`. Built-in values
+// are PROJECT_ID, PROJECT_NUMBER, REGION, SERVICE_NAME, JOB_NAME, REVISION,
+// INSTANCE_ID and SERVICE_ACCOUNT_EMAIL, keys in the config store take
+// precedence. Unresolved references and cycles are reported as errors.
 func GetConfig(key string) (string, error) {
-	ensureInitConfig()
-	val, ok := config[key]
+	entry, err := getConfigEntry(key)
+	return entry.value, err
+}
+
+// getConfigEntry retrieves the entry for the key, resolves secret references
+// in its value and interpolates references to other keys if enabled.
+func getConfigEntry(key string) (configEntry, error) {
+	entry, err := lookupConfigEntry(key)
+	if err != nil {
+		return entry, err
+	}
+	return newInterpolator(func(key string) (configEntry, bool) {
+		entry, err := lookupConfigEntry(key)
+		return entry, err == nil
+	}).resolve(key, entry)
+}
+
+// resolveConfigEntry resolves secret references in the value of the entry.
+func resolveConfigEntry(key string, entry configEntry) (configEntry, error) {
+	if isSecretReference(entry.value) {
+		value, err := resolveSecretReference(entry.value)
+		if err != nil {
+			return configEntry{}, fmt.Errorf("failed to resolve secret for config key '%s': %w", key, err)
+		}
+		entry.value = value
+		entry.secret = true
+	}
+	return entry, nil
+}
+
+// lookupConfigEntry retrieves the entry for the key as stored.
+func lookupConfigEntry(key string) (configEntry, error) {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	entry, ok := config[key]
 	if !ok {
-		return "", fmt.Errorf("no config found for key: '%s'", key)
+		return configEntry{}, fmt.Errorf("no config found for key: '%s'", key)
+	}
+	return entry, nil
+}
+
+// GetInt retrieves a value for a key from the global config store and parses
+// it as an int.
+func GetInt(key string) (int, error) {
+	return getTyped(key, "int", strconv.Atoi)
+}
+
+// GetIntOr retrieves a value for a key from the global config store and parses
+// it as an int. It returns the default value if the key is missing or invalid.
+func GetIntOr(key string, def int) int {
+	return getTypedOr(key, def, GetInt)
+}
+
+// GetBool retrieves a value for a key from the global config store and parses
+// it as a bool, accepting the values supported by strconv.ParseBool.
+func GetBool(key string) (bool, error) {
+	return getTyped(key, "bool", strconv.ParseBool)
+}
+
+// GetBoolOr retrieves a value for a key from the global config store and
+// parses it as a bool. It returns the default value if the key is missing or
+// invalid.
+func GetBoolOr(key string, def bool) bool {
+	return getTypedOr(key, def, GetBool)
+}
+
+// GetDuration retrieves a value for a key from the global config store and
+// parses it as a duration, e.g. `1m30s`.
+func GetDuration(key string) (time.Duration, error) {
+	return getTyped(key, "duration", time.ParseDuration)
+}
+
+// GetDurationOr retrieves a value for a key from the global config store and
+// parses it as a duration. It returns the default value if the key is missing
+// or invalid.
+func GetDurationOr(key string, def time.Duration) time.Duration {
+	return getTypedOr(key, def, GetDuration)
+}
+
+// GetFloat retrieves a value for a key from the global config store and
+// parses it as a float64.
+func GetFloat(key string) (float64, error) {
+	return getTyped(key, "float", func(val string) (float64, error) {
+		return strconv.ParseFloat(val, 64)
+	})
+}
+
+// GetFloatOr retrieves a value for a key from the global config store and
+// parses it as a float64. It returns the default value if the key is missing
+// or invalid.
+func GetFloatOr(key string, def float64) float64 {
+	return getTypedOr(key, def, GetFloat)
+}
+
+// GetStringSlice retrieves a value for a key from the global config store and
+// splits it by commas into a slice of trimmed, non-empty strings.
+func GetStringSlice(key string) ([]string, error) {
+	return getTyped(key, "string slice", func(val string) ([]string, error) {
+		return splitList(val), nil
+	})
+}
+
+// GetStringSliceOr retrieves a value for a key from the global config store
+// and splits it by commas. It returns the default value if the key is
+// missing.
+func GetStringSliceOr(key string, def []string) []string {
+	return getTypedOr(key, def, GetStringSlice)
+}
+
+// GetURL retrieves a value for a key from the global config store and parses
+// it as an absolute URL.
+func GetURL(key string) (*url.URL, error) {
+	return getTyped(key, "URL", parseAbsoluteURL)
+}
+
+// GetURLOr retrieves a value for a key from the global config store and
+// parses it as an absolute URL. It returns the default value if the key is
+// missing or invalid.
+func GetURLOr(key string, def *url.URL) *url.URL {
+	return getTypedOr(key, def, GetURL)
+}
+
+// getTyped retrieves the value for the key and parses it. Parse errors include
+// the key and the source of the value.
+func getTyped[T any](key string, kind string, parse func(string) (T, error)) (T, error) {
+	entry, err := getConfigEntry(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	val, err := parse(entry.value)
+	if err != nil {
+		if entry.secret {
+			// Parse errors tend to quote the value
+			err = errors.New("value redacted")
+		}
+		return val, fmt.Errorf(
+			"invalid %s value for config key '%s' from source '%s': %w",
+			kind,
+			key,
+			entry.source,
+			err,
+		)
 	}
 	return val, nil
 }
 
-// ListConfigKeys returns a list of all currently available keys in the global
-// config store.
-func ListConfigKeys() []string {
-	ensureInitConfig()
-	keys := make([]string, 0, len(config))
-	for key := range config {
-		keys = append(keys, key)
+// getTypedOr returns the default value if the key is missing or invalid.
+// Invalid values are logged.
+func getTypedOr[T any](key string, def T, get func(string) (T, error)) T {
+	if _, err := lookupConfigEntry(key); err != nil {
+		return def
+	}
+	val, err := get(key)
+	if err != nil {
+		Warningf(nil, "using default for config key '%s': %v", key, err)
+		return def
+	}
+	return val
+}
+
+func splitList(val string) []string {
+	list := []string{}
+	for _, elem := range strings.Split(val, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem != "" {
+			list = append(list, elem)
+		}
 	}
-	return keys
+	return list
+}
+
+func parseAbsoluteURL(val string) (*url.URL, error) {
+	parsed, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return nil, fmt.Errorf("not an absolute URL: '%s'", val)
+	}
+	return parsed, nil
+}
+
+// ListConfigKeys returns a sorted list of all currently available keys in the
+// global config store.
+func ListConfigKeys() []string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return slices.Sorted(maps.Keys(config))
 }
 
 // LoadConfig lookups the named environment variable, puts it's value into
 // the global config store and returns the value.
 func LoadConfig(env string) (string, error) {
-	ensureInitConfig()
 	val := os.Getenv(env)
 	if val == "" {
 		return "", fmt.Errorf("unable to find value for env var: '%s'", env)
 	}
 
-	PutConfig(env, val)
+	putConfig(env, val, configSourceEnv)
 
 	return val, nil
 }
@@ -74,17 +368,10 @@ func LoadConfig(env string) (string, error) {
 // LoadAllConfig loads all available environment variables and puts it in the
 // config store.
 func LoadAllConfig() {
-	ensureInitConfig()
 	for _, pair := range os.Environ() {
 		key, value, ok := strings.Cut(pair, "=")
 		if ok {
-			PutConfig(key, value)
+			putConfig(key, value, configSourceEnv)
 		}
 	}
 }
-
-func ensureInitConfig() {
-	if config == nil {
-		ResetConfig()
-	}
-}
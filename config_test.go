@@ -0,0 +1,266 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTypedConfigGetters(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("int", "42")
+	PutConfig("bool", "true")
+	PutConfig("duration", "1m30s")
+	PutConfig("float", "0.25")
+	PutConfig("slice", " a, b,,c ")
+	PutConfig("url", "https://example.com/path")
+	PutConfig("invalid", "not-a-number")
+
+	tests := []struct {
+		name     string
+		get      func() (any, error)
+		expected any
+	}{
+		{"int", func() (any, error) { return GetInt("int") }, 42},
+		{"bool", func() (any, error) { return GetBool("bool") }, true},
+		{"duration", func() (any, error) { return GetDuration("duration") }, 90 * time.Second},
+		{"float", func() (any, error) { return GetFloat("float") }, 0.25},
+		{"slice", func() (any, error) { return GetStringSlice("slice") }, []string{"a", "b", "c"}},
+		{"url", func() (any, error) {
+			u, err := GetURL("url")
+			return u.String(), err
+		}, "https://example.com/path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	_, err := GetInt("invalid")
+	if err == nil || !strings.Contains(err.Error(), "'invalid'") || !strings.Contains(err.Error(), "'memory'") {
+		t.Fatalf("expected error naming key and source, got %v", err)
+	}
+	if got := GetIntOr("invalid", 7); got != 7 {
+		t.Fatalf("expected default for invalid value, got %d", got)
+	}
+	if got := GetDurationOr("missing", time.Second); got != time.Second {
+		t.Fatalf("expected default for missing value, got %s", got)
+	}
+}
+
+func TestLoadConfigSources(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "config.json")
+	yamlPath := filepath.Join(dir, "config.yaml")
+	dotEnvPath := filepath.Join(dir, ".env")
+	writeFile(t, jsonPath, `{"db": {"host": "json-host", "port": 5432}, "tags": ["a", "b"]}`)
+	writeFile(t, yamlPath, "db:\n  host: yaml-host\n  user: yaml-user\n")
+	writeFile(t, dotEnvPath, "# comment\nexport DB_PASSWORD=\"s3cr3t\"\nREGION=local # trailing\n")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("db.user", "", "")
+	flags.String("unset", "flag-default", "")
+	if err := flags.Parse([]string{"-db.user=flag-user"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	err := LoadConfigSources(
+		FlagSource(flags),
+		DotEnvSource(dotEnvPath),
+		YAMLFileSource(yamlPath),
+		JSONFileSource(jsonPath),
+		DefaultsSource(map[string]string{"db.host": "default-host", "db.name": "app"}),
+	)
+	if err != nil {
+		t.Fatalf("failed to load sources: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		origin string
+	}{
+		{"db.user", "flag-user", "flags"},
+		{"DB_PASSWORD", "s3cr3t", "dotenv:" + dotEnvPath},
+		{"REGION", "local", "dotenv:" + dotEnvPath},
+		{"db.host", "yaml-host", "yaml:" + yamlPath},
+		{"db.port", "5432", "json:" + jsonPath},
+		{"tags", "a,b", "json:" + jsonPath},
+		{"db.name", "app", "defaults"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, err := GetConfig(tt.key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			origin, _ := ConfigOrigin(tt.key)
+			if value != tt.value || origin != tt.origin {
+				t.Fatalf("expected %q from %q, got %q from %q", tt.value, tt.origin, value, origin)
+			}
+		})
+	}
+
+	if _, err := GetConfig("unset"); err == nil {
+		t.Fatal("expected flags which were not set to be skipped")
+	}
+	if err := LoadConfigSources(JSONFileSource(filepath.Join(dir, "missing.json"))); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestReloadConfigKeepsPrecedenceOfFailedSource(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	defer LoadConfigSources()
+
+	var fail bool
+	high := funcSource{"high", func() (map[string]string, error) {
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return map[string]string{"K": "high"}, nil
+	}}
+	low := DefaultsSource(map[string]string{"K": "low", "L": "low"})
+	if err := LoadConfigSources(high, low); err != nil {
+		t.Fatalf("failed to load sources: %v", err)
+	}
+
+	fail = true
+	if err := ReloadConfig(); err == nil {
+		t.Fatal("expected error of failed source")
+	}
+	if value, _ := GetConfig("K"); value != "high" {
+		t.Fatalf("expected value of failed source with higher precedence to be kept, got %q", value)
+	}
+	if origin, _ := ConfigOrigin("K"); origin != "high" {
+		t.Fatalf("expected origin of failed source to be kept, got %q", origin)
+	}
+	if value, _ := GetConfig("L"); value != "low" {
+		t.Fatalf("expected value of lower precedence source, got %q", value)
+	}
+
+	fail = false
+	if err := ReloadConfig(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if value, _ := GetConfig("K"); value != "high" {
+		t.Fatalf("expected value of recovered source, got %q", value)
+	}
+}
+
+func TestSecretVolumeSource(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "..data"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "db", "password"), "v1\n")
+	writeFile(t, filepath.Join(dir, "..data", "password"), "internal")
+
+	source := SecretVolumeSource(dir)
+	if err := LoadConfigSources(source); err != nil {
+		t.Fatalf("failed to load secrets: %v", err)
+	}
+
+	if val, _ := GetConfig("db.password"); val != "v1" {
+		t.Fatalf("expected secret value, got %q", val)
+	}
+	if !IsSecretConfig("db.password") {
+		t.Fatal("expected key to be marked secret")
+	}
+	if listing := ListConfig(); len(listing) != 1 || listing["db.password"] != redactedConfigValue {
+		t.Fatalf("expected redacted listing with single key, got %v", listing)
+	}
+	if _, err := GetInt("db.password"); err == nil || strings.Contains(err.Error(), "v1") {
+		t.Fatalf("expected parse error without value, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.Watch(ctx, 10*time.Millisecond)
+	awaitSecretReload(t, filepath.Join(dir, "db", "password"), "db.password")
+}
+
+func TestSecretVolumeWatchUnloaded(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "token"), "v1")
+	if err := LoadConfigSources(DefaultsSource(map[string]string{"PORT": "8080"})); err != nil {
+		t.Fatalf("failed to load defaults: %v", err)
+	}
+	defer LoadConfigSources()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	source := SecretVolumeSource(dir)
+	go source.Watch(ctx, 10*time.Millisecond)
+	awaitSecretReload(t, filepath.Join(dir, "token"), "token")
+
+	if !IsSecretConfig("token") {
+		t.Fatal("expected reloaded key to be marked secret")
+	}
+	if val, _ := GetConfig("PORT"); val != "8080" {
+		t.Fatalf("expected loaded sources to be kept, got %q", val)
+	}
+}
+
+// awaitSecretReload keeps rewriting the secret file until the watched key
+// holds a new value. Writing once is not enough, as the watcher may only take
+// its initial snapshot after the write.
+func awaitSecretReload(t *testing.T, path string, key string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for i := 2; time.Now().Before(deadline); i++ {
+		writeFile(t, path, fmt.Sprintf("v%d\n", i))
+		time.Sleep(10 * time.Millisecond)
+		if val, err := GetConfig(key); err == nil && val != "v1" {
+			return
+		}
+	}
+	t.Fatalf("expected '%s' to be reloaded after change", key)
+}
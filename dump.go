@@ -0,0 +1,211 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sensitiveConfigKey matches keys which likely hold sensitive values, even
+// if they are not marked as secret.
+var sensitiveConfigKey = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|credential|private.?key|api.?key|access.?key)`)
+
+const (
+	// ConfigDriftMissing reports a declared environment variable which is
+	// neither in the global config store nor in the environment.
+	ConfigDriftMissing = "missing"
+	// ConfigDriftChanged reports a resolved value which differs from the
+	// value of the declared environment variable.
+	ConfigDriftChanged = "changed"
+)
+
+// ConfigInfo describes a key of the global config store for debugging
+// purposes.
+type ConfigInfo struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Source   string `json:"source"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+// ConfigDrift describes a difference between an environment variable
+// declared in the KNative service spec and the value resolved by this
+// instance.
+type ConfigDrift struct {
+	Key      string `json:"key"`
+	Status   string `json:"status"`
+	Declared string `json:"declared,omitempty"`
+	Resolved string `json:"resolved,omitempty"`
+	Source   string `json:"source,omitempty"`
+}
+
+// ConfigDump is the complete debugging information on the resolved config,
+// see DumpConfig.
+type ConfigDump struct {
+	Config     []ConfigInfo  `json:"config"`
+	Drift      []ConfigDrift `json:"drift,omitempty"`
+	DriftError string        `json:"driftError,omitempty"`
+}
+
+// DescribeConfig returns information on all keys in the global config store
+// sorted by key. Values of secret keys, of keys which look sensitive, e.g.
+// `DB_PASSWORD`, and of environment variables which the service spec injects
+// from secrets are redacted. If the service spec cannot be loaded, the values
+// of all keys from the environment are redacted.
+func DescribeConfig() []ConfigInfo {
+	secretEnv, err := declaredSecretEnv()
+	return describeConfig(ConfigSnapshot(), secretEnv, err != nil)
+}
+
+// describeConfig describes the snapshot, redacting secretEnv and, if redactEnv
+// is set, all keys from the environment.
+func describeConfig(snapshot ConfigView, secretEnv map[string]bool, redactEnv bool) []ConfigInfo {
+	infos := make([]ConfigInfo, 0, snapshot.Len())
+	for _, key := range snapshot.Keys() {
+		entry := snapshot.entries[key]
+		info := ConfigInfo{Key: key, Value: entry.value, Source: entry.source}
+		fromEnv := redactEnv && entry.source == configSourceEnv
+		if fromEnv || secretEnv[key] || isSensitiveConfig(key, entry) {
+			info.Value = redactedConfigValue
+			info.Redacted = true
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DiffConfigEnv compares the environment variables declared for the serving
+// container in the KNative service spec, see KNativeService, with the values
+// resolved by this instance. Values are resolved from the global config store,
+// falling back to the environment. Variables referencing secrets are only
+// checked for presence.
+func DiffConfigEnv() ([]ConfigDrift, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load declared environment: %w", err)
+	}
+	containers := service.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	return diffConfigEnv(servingContainer(containers).Env, ConfigSnapshot()), nil
+}
+
+func diffConfigEnv(declared []corev1.EnvVar, snapshot ConfigView) []ConfigDrift {
+	drifts := []ConfigDrift{}
+	for _, env := range declared {
+		entry, ok := snapshot.entries[env.Name]
+		if !ok {
+			var value string
+			value, ok = os.LookupEnv(env.Name)
+			entry = configEntry{value: value, source: configSourceEnv}
+		}
+		if !ok {
+			drifts = append(drifts, ConfigDrift{Key: env.Name, Status: ConfigDriftMissing})
+			continue
+		}
+		if env.ValueFrom != nil || entry.value == env.Value {
+			continue
+		}
+
+		drift := ConfigDrift{
+			Key:      env.Name,
+			Status:   ConfigDriftChanged,
+			Declared: env.Value,
+			Resolved: entry.value,
+			Source:   entry.source,
+		}
+		if isSensitiveConfig(env.Name, entry) {
+			drift.Declared = redactedConfigValue
+			drift.Resolved = redactedConfigValue
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// declaredSecretEnv returns the names of the environment variables which the
+// service spec injects from secrets, e.g. with `valueFrom.secretKeyRef`.
+func declaredSecretEnv() (map[string]bool, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return nil, err
+	}
+	if len(service.Spec.Template.Spec.Containers) == 0 {
+		return nil, nil
+	}
+	secretEnv := make(map[string]bool)
+	for _, env := range servingContainer(service.Spec.Template.Spec.Containers).Env {
+		if env.ValueFrom != nil {
+			secretEnv[env.Name] = true
+		}
+	}
+	return secretEnv, nil
+}
+
+func isSensitiveConfig(key string, entry configEntry) bool {
+	return entry.secret || isSecretReference(entry.value) || sensitiveConfigKey.MatchString(key)
+}
+
+// DumpConfig returns the redacted config of this instance along with the
+// drift to the declared environment, see DescribeConfig and DiffConfigEnv.
+func DumpConfig() ConfigDump {
+	dump := ConfigDump{Config: DescribeConfig()}
+	drift, err := DiffConfigEnv()
+	if err != nil {
+		dump.DriftError = err.Error()
+	}
+	dump.Drift = drift
+	return dump
+}
+
+// LogConfig logs the redacted config of this instance in a single line and
+// every drift to the declared environment as a warning.
+func LogConfig() {
+	dump := DumpConfig()
+	pairs := make([]string, 0, len(dump.Config))
+	for _, info := range dump.Config {
+		pairs = append(pairs, fmt.Sprintf("%s=%q (%s)", info.Key, info.Value, info.Source))
+	}
+	Infof(nil, "resolved config: %s", strings.Join(pairs, ", "))
+
+	if dump.DriftError != "" {
+		Debugf(nil, "skipping config drift: %s", dump.DriftError)
+	}
+	for _, drift := range dump.Drift {
+		switch drift.Status {
+		case ConfigDriftMissing:
+			Warningf(nil, "config drift: declared env var '%s' is missing", drift.Key)
+		default:
+			Warningf(nil, "config drift: '%s' is %q (%s) but declared as %q", drift.Key, drift.Resolved, drift.Source, drift.Declared)
+		}
+	}
+}
+
+// ConfigHandler returns an HTTP handler which responds with the redacted
+// config of this instance as JSON, see DumpConfig.
+func ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DumpConfig()); err != nil {
+			Error(r, err)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// flagConfigPrefix is the prefix of config keys backing feature flags.
+	flagConfigPrefix = "flag."
+	// flagAllowPrefix marks the value of an allow-list flag.
+	flagAllowPrefix = "allow:"
+	// flagBuckets is the number of buckets for percentage rollouts, allowing
+	// a resolution of 0.01%.
+	flagBuckets = 10000
+)
+
+// FeatureFlag is a feature flag backed by the global config store, see Flag.
+type FeatureFlag struct {
+	name      string
+	def       bool
+	attribute func(*http.Request) string
+}
+
+// FlagOption configures a feature flag.
+type FlagOption func(*FeatureFlag)
+
+// FlagDefault sets the value of the flag if it is not configured or
+// configured with an invalid value. Flags default to false.
+func FlagDefault(enabled bool) FlagOption {
+	return func(f *FeatureFlag) {
+		f.def = enabled
+	}
+}
+
+// FlagAttribute buckets requests by the attribute returned by key, e.g. a
+// user ID, rather than by InstanceID. Requests without attribute are bucketed
+// by InstanceID.
+func FlagAttribute(key func(r *http.Request) string) FlagOption {
+	return func(f *FeatureFlag) {
+		f.attribute = key
+	}
+}
+
+// FlagHeader buckets requests by the value of the request header.
+func FlagHeader(header string) FlagOption {
+	return FlagAttribute(func(r *http.Request) string {
+		return r.Header.Get(header)
+	})
+}
+
+// Flag returns the feature flag with the given name. The flag is evaluated
+// from the config key `flag.<name>` on every check, so that changes of the
+// config apply immediately. The value selects the variant of the flag:
+//
+//   - `true` or `false` enables or disables the flag for everyone.
+//   - `25%` enables the flag for a stable share of all bucketing keys.
+//   - `allow:alice,bob` enables the flag for the listed bucketing keys only.
+//
+// A value for the key `flag.<name>@<revision>` overrides the flag for the
+// revision, see Revision, e.g. to enable a feature on a tagged revision only.
+func Flag(name string, opts ...FlagOption) *FeatureFlag {
+	f := &FeatureFlag{name: name}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Name returns the name of the flag.
+func (f *FeatureFlag) Name() string {
+	return f.name
+}
+
+// Enabled reports whether the flag is enabled for the request. The request is
+// bucketed by the attribute configured with FlagAttribute or FlagHeader, or
+// by InstanceID otherwise. The evaluation is logged at DEBUG severity and
+// correlated with the trace of the request.
+func (f *FeatureFlag) Enabled(r *http.Request) bool {
+	var key string
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+		if f.attribute != nil {
+			key = f.attribute(r)
+		}
+	}
+	return f.evaluate(ctx, r, key)
+}
+
+// EnabledFor reports whether the flag is enabled for the bucketing key, e.g.
+// a user ID. An empty key buckets by InstanceID. The evaluation is logged at
+// DEBUG severity with the values attached to the context, see LogContext.
+func (f *FeatureFlag) EnabledFor(ctx context.Context, key string) bool {
+	return f.evaluate(ctx, nil, key)
+}
+
+func (f *FeatureFlag) evaluate(ctx context.Context, r *http.Request, key string) bool {
+	if key == "" {
+		key = InstanceID()
+	}
+	configKey, value, ok := f.lookup()
+	if !ok {
+		logWithContext(ctx, r, 3, "DEBUG", "flag '%s' is %t: not configured", f.name, f.def)
+		return f.def
+	}
+
+	enabled, reason, err := f.match(value, key)
+	if err != nil {
+		logWithContext(ctx, r, 3, "WARNING", "flag '%s' is %t: invalid value for '%s': %v", f.name, f.def, configKey, err)
+		return f.def
+	}
+	logWithContext(ctx, r, 3, "DEBUG", "flag '%s' is %t: %s from '%s'", f.name, enabled, reason, configKey)
+	return enabled
+}
+
+// lookup returns the config key and value of the flag, preferring the
+// override for the current revision.
+func (f *FeatureFlag) lookup() (string, string, bool) {
+	for _, configKey := range []string{
+		flagConfigPrefix + f.name + "@" + Revision(),
+		flagConfigPrefix + f.name,
+	} {
+		if value, err := GetConfig(configKey); err == nil {
+			return configKey, value, true
+		}
+	}
+	return "", "", false
+}
+
+// match evaluates the flag value for the bucketing key and describes the
+// matching rule.
+func (f *FeatureFlag) match(value string, key string) (bool, string, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, flagAllowPrefix):
+		allowed := slices.Contains(splitList(strings.TrimPrefix(value, flagAllowPrefix)), key)
+		return allowed, "allow-list", nil
+	case strings.HasSuffix(value, "%"):
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return false, "", fmt.Errorf("expected percentage between 0%% and 100%%, got '%s'", value)
+		}
+		bucket := f.bucket(key)
+		return float64(bucket) < percentage*flagBuckets/100, fmt.Sprintf("bucket %d of %s rollout", bucket, value), nil
+	default:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, "", fmt.Errorf("expected boolean, percentage or allow-list, got '%s'", value)
+		}
+		return enabled, "boolean", nil
+	}
+}
+
+// bucket deterministically assigns the bucketing key to one of flagBuckets
+// buckets. The flag name is part of the hash, so that rollouts of different
+// flags are independent.
+func (f *FeatureFlag) bucket(key string) int {
+	hash := fnv.New64a()
+	hash.Write([]byte(f.name))
+	hash.Write([]byte{0})
+	hash.Write([]byte(key))
+	return int(hash.Sum64() % flagBuckets)
+}
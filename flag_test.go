@@ -0,0 +1,92 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlagVariants(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	ResetCache()
+	defer ResetCache()
+	this.instanceID = "instance"
+	this.serviceRevision = "svc-00002-abc"
+
+	PutConfig("flag.on", "true")
+	PutConfig("flag.off", "false")
+	PutConfig("flag.beta", "allow:alice, bob")
+	PutConfig("flag.invalid", "maybe")
+	PutConfig("flag.canary", "false")
+	PutConfig("flag.canary@svc-00002-abc", "true")
+
+	ctx := context.Background()
+	tests := []struct {
+		flag     *FeatureFlag
+		key      string
+		expected bool
+	}{
+		{Flag("on"), "", true},
+		{Flag("off"), "", false},
+		{Flag("missing"), "", false},
+		{Flag("missing", FlagDefault(true)), "", true},
+		{Flag("invalid", FlagDefault(true)), "", true},
+		{Flag("beta"), "bob", true},
+		{Flag("beta"), "carol", false},
+		{Flag("canary"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.flag.Name(), tt.key), func(t *testing.T) {
+			if got := tt.flag.EnabledFor(ctx, tt.key); got != tt.expected {
+				t.Fatalf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User", "alice")
+	if !Flag("beta", FlagHeader("X-User")).Enabled(r) {
+		t.Fatal("expected flag to be enabled for header attribute")
+	}
+}
+
+func TestFlagPercentage(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("flag.rollout", "25%")
+	flag := Flag("rollout")
+	enabled := 0
+	for i := range flagBuckets {
+		key := fmt.Sprintf("user-%d", i)
+		first := flag.EnabledFor(context.Background(), key)
+		if first != flag.EnabledFor(context.Background(), key) {
+			t.Fatalf("expected deterministic bucketing for %s", key)
+		}
+		if first {
+			enabled++
+		}
+	}
+	if enabled < 2300 || enabled > 2700 {
+		t.Fatalf("expected about 25%% of keys to be enabled, got %d of %d", enabled, flagBuckets)
+	}
+
+	PutConfig("flag.rollout", "101%")
+	if flag.EnabledFor(context.Background(), "user") {
+		t.Fatal("expected invalid percentage to fall back to default")
+	}
+}
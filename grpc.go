@@ -0,0 +1,175 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	peer "google.golang.org/grpc/peer"
+	status "google.golang.org/grpc/status"
+)
+
+var (
+	grpcLogSeverities = map[codes.Code]string{
+		codes.OK:                 "DEBUG",
+		codes.Canceled:           "INFO",
+		codes.InvalidArgument:    "WARNING",
+		codes.NotFound:           "WARNING",
+		codes.AlreadyExists:      "WARNING",
+		codes.PermissionDenied:   "WARNING",
+		codes.ResourceExhausted:  "WARNING",
+		codes.FailedPrecondition: "WARNING",
+		codes.Aborted:            "WARNING",
+		codes.OutOfRange:         "WARNING",
+		codes.Unauthenticated:    "WARNING",
+		codes.Unknown:            "ERROR",
+		codes.DeadlineExceeded:   "ERROR",
+		codes.Unimplemented:      "ERROR",
+		codes.Internal:           "ERROR",
+		codes.Unavailable:        "ERROR",
+		codes.DataLoss:           "ERROR",
+	}
+	grpcLogSeveritiesMu sync.RWMutex
+
+	// grpcServers holds the servers created with NewGRPCServer.
+	grpcServers sync.Map
+)
+
+// SetGRPCLogSeverity configures the severity with which the GRPC interceptors
+// log RPCs completing with the given status code. An empty severity disables
+// logging for that code.
+func SetGRPCLogSeverity(code codes.Code, severity string) {
+	grpcLogSeveritiesMu.Lock()
+	defer grpcLogSeveritiesMu.Unlock()
+	grpcLogSeverities[code] = severity
+}
+
+// NewGRPCServer creates a GRPC server with the logging and trace interceptors
+// of this package installed in front of any interceptors supplied in opts.
+//
+// Interceptors can only be configured when a server is created, so servers
+// passed to ServeGRPC should be created with this function.
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor()),
+	}, opts...)
+	server := grpc.NewServer(opts...)
+	grpcServers.Store(server, true)
+	return server
+}
+
+// isInterceptedGRPCServer reports whether the server was created with
+// NewGRPCServer.
+func isInterceptedGRPCServer(server *grpc.Server) bool {
+	_, ok := grpcServers.Load(server)
+	return ok
+}
+
+// UnaryServerInterceptor returns a GRPC interceptor for unary RPCs which
+// attaches the trace from the incoming metadata to the context and logs
+// every RPC with its method, status code, latency and peer.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx = grpcTraceContext(ctx)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a GRPC interceptor for streaming RPCs which
+// attaches the trace from the incoming metadata to the context of the stream
+// and logs every RPC with its method, status code, latency and peer.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx := grpcTraceContext(stream.Context())
+		start := time.Now()
+		err := handler(srv, &tracedServerStream{stream, ctx})
+		logRPC(ctx, info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcTraceContext(ctx context.Context) context.Context {
+	md, ok := grpcmetadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	traceID := parseTraceID(
+		firstMetadataValue(md, "x-cloud-trace-context"),
+		firstMetadataValue(md, "traceparent"),
+	)
+	if traceID == "" {
+		return ctx
+	}
+	return ContextWithTrace(ctx, traceID)
+}
+
+func firstMetadataValue(md grpcmetadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func logRPC(ctx context.Context, method string, err error, latency time.Duration) {
+	code := status.Code(err)
+
+	grpcLogSeveritiesMu.RLock()
+	severity, ok := grpcLogSeverities[code]
+	grpcLogSeveritiesMu.RUnlock()
+	if !ok {
+		severity = "ERROR"
+	}
+	if severity == "" {
+		return
+	}
+
+	address := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		address = p.Addr.String()
+	}
+
+	if err != nil {
+		logWithContext(ctx, nil, 2, severity, "%s %s %s %s: %v", method, code, latency, address, err)
+		return
+	}
+	logWithContext(ctx, nil, 2, severity, "%s %s %s %s", method, code, latency, address)
+}
@@ -0,0 +1,185 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	insecure "google.golang.org/grpc/credentials/insecure"
+	health "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	status "google.golang.org/grpc/status"
+	bufconn "google.golang.org/grpc/test/bufconn"
+)
+
+func startGRPCTestServer(t *testing.T) healthpb.HealthClient {
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("svc", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	ResetCache()
+	defer ResetCache()
+	this.projectID = "my-project"
+	buf := captureLog(t)
+	client := startGRPCTestServer(t)
+
+	tests := []struct {
+		name          string
+		metadata      []string
+		service       string
+		expectedTrace string
+		expectedLevel string
+	}{
+		{
+			name:          "cloud trace context",
+			metadata:      []string{"x-cloud-trace-context", "105445aa7843bc8bf206b12000100000/1;o=1"},
+			service:       "svc",
+			expectedTrace: "projects/my-project/traces/105445aa7843bc8bf206b12000100000",
+			expectedLevel: "DEBUG",
+		},
+		{
+			name:          "traceparent",
+			metadata:      []string{"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			service:       "svc",
+			expectedTrace: "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedLevel: "DEBUG",
+		},
+		{
+			name:          "without trace",
+			service:       "unknown",
+			expectedLevel: "WARNING",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+			ctx := grpcmetadata.AppendToOutgoingContext(context.Background(), test.metadata...)
+			client.Check(ctx, &healthpb.HealthCheckRequest{Service: test.service})
+
+			entries := buf.entries(t)
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 log entry, got %d", len(entries))
+			}
+			entry := entries[0]
+			if entry.Trace != test.expectedTrace {
+				t.Errorf("expected trace '%s', got '%s'", test.expectedTrace, entry.Trace)
+			}
+			if entry.Severity != test.expectedLevel {
+				t.Errorf("expected severity %s, got %s", test.expectedLevel, entry.Severity)
+			}
+			if !strings.HasPrefix(entry.Message, "/grpc.health.v1.Health/Check ") {
+				t.Errorf("expected message to start with the method, got '%s'", entry.Message)
+			}
+			if entry.SourceLocation == nil || !strings.HasSuffix(entry.SourceLocation.File, "grpc.go") {
+				t.Errorf("expected source location in grpc.go, got %+v", entry.SourceLocation)
+			}
+		})
+	}
+}
+
+func TestSetGRPCLogSeverity(t *testing.T) {
+	buf := captureLog(t)
+	client := startGRPCTestServer(t)
+
+	SetGRPCLogSeverity(codes.NotFound, "")
+	defer SetGRPCLogSeverity(codes.NotFound, "WARNING")
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	if entries := buf.entries(t); len(entries) != 0 {
+		t.Errorf("expected no log entries, got %+v", entries)
+	}
+
+	SetGRPCLogSeverity(codes.NotFound, "ERROR")
+	client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	entries := buf.entries(t)
+	if len(entries) != 1 || entries[0].Severity != "ERROR" {
+		t.Fatalf("expected 1 entry with severity ERROR, got %+v", entries)
+	}
+	if !strings.Contains(entries[0].Message, "NotFound") {
+		t.Errorf("expected message to contain the status code, got '%s'", entries[0].Message)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	ResetCache()
+	defer ResetCache()
+	this.projectID = "my-project"
+	buf := captureLog(t)
+	client := startGRPCTestServer(t)
+
+	ctx, cancel := context.WithCancel(grpcmetadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "svc"})
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	cancel()
+
+	// The stream is logged once the handler observes the cancellation.
+	deadline := time.Now().Add(time.Second)
+	var entries []LogEntry
+	for len(entries) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		entries = buf.entries(t)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d", len(entries))
+	}
+	expectedTrace := "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736"
+	if entries[0].Trace != expectedTrace {
+		t.Errorf("expected trace '%s', got '%s'", expectedTrace, entries[0].Trace)
+	}
+	if !strings.HasPrefix(entries[0].Message, "/grpc.health.v1.Health/Watch Canceled ") {
+		t.Errorf("expected message to start with the method and code, got '%s'", entries[0].Message)
+	}
+}
+
+func TestIsInterceptedGRPCServer(t *testing.T) {
+	if !isInterceptedGRPCServer(NewGRPCServer()) {
+		t.Error("expected server created with NewGRPCServer to be intercepted")
+	}
+	if isInterceptedGRPCServer(grpc.NewServer()) {
+		t.Error("expected server created with grpc.NewServer not to be intercepted")
+	}
+}
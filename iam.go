@@ -0,0 +1,142 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// AdminPermission is the IAM permission on the Cloud Run service required to
+// access admin handlers like ClientsHandler.
+const AdminPermission = "run.services.get"
+
+// ConfigAdminPermission is the IAM permission on the Cloud Run service required
+// to access ConfigHandler. Unlike AdminPermission, it is not granted to mere
+// viewers of the service, e.g. by `roles/run.viewer`.
+const ConfigAdminPermission = "run.services.update"
+
+var (
+	iamEndpoint    = "https://run.googleapis.com"
+	iamLocalBypass atomic.Bool
+)
+
+// SetIAMEndpoint configures the Cloud Run Admin API endpoint used to test the
+// IAM permissions of callers, e.g. to point to a local fake server in tests.
+func SetIAMEndpoint(endpoint string) {
+	iamEndpoint = strings.TrimSuffix(endpoint, "/")
+}
+
+// SetIAMLocalBypass configures whether RequireIAMPermission admits all callers
+// if the current process does not seem to be hosted on Cloud Run, e.g. during
+// local development. It is disabled by default, as the check relies on
+// `K_SERVICE` being set, which is missing for any deployment outside of
+// Cloud Run.
+func SetIAMLocalBypass(enabled bool) {
+	iamLocalBypass.Store(enabled)
+}
+
+// RequireIAMPermission wraps the handler with an access check, which only
+// admits callers holding the given IAM permission on this Cloud Run service.
+//
+// Callers authenticate with an OAuth2 access token in the `Authorization`
+// header. If the service requires authentication for invocation, the identity
+// token can be passed in the `X-Serverless-Authorization` header instead.
+//
+// If the current process does not seem to be hosted on Cloud Run, all callers
+// are rejected unless enabled with SetIAMLocalBypass.
+func RequireIAMPermission(permission string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ResourceType() == LocalResource {
+			if iamLocalBypass.Load() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "cannot test permissions outside of Cloud Run", http.StatusForbidden)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		granted, err := testIAMPermission(r, token, permission)
+		if err != nil {
+			Warningf(r, "failed to test IAM permission '%s': %v", permission, err)
+			http.Error(w, "failed to test permission", http.StatusForbidden)
+			return
+		}
+		if !granted {
+			http.Error(w, fmt.Sprintf("missing permission '%s'", permission), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// testIAMPermission tests whether the owner of the access token holds the
+// permission on this Cloud Run service.
+func testIAMPermission(r *http.Request, token string, permission string) (bool, error) {
+	url := fmt.Sprintf(
+		"%s/v2/projects/%s/locations/%s/services/%s:testIamPermissions",
+		iamEndpoint,
+		ProjectID(),
+		Region(),
+		ServiceName(),
+	)
+	body, err := json.Marshal(map[string][]string{"permissions": {permission}})
+	if err != nil {
+		return false, err
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New(resp.Status)
+	}
+
+	var result struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return false, err
+	}
+	return slices.Contains(result.Permissions, permission), nil
+}
@@ -0,0 +1,95 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireIAMPermission(t *testing.T) {
+	t.Setenv("K_SERVICE", "svc")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+	ResetCache()
+	defer ResetCache()
+	this.region = "europe-west1" // Skip the metadata server
+
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedPath := "/v2/projects/my-project/locations/europe-west1/services/svc:testIamPermissions"
+		if r.URL.Path != expectedPath {
+			t.Errorf("expected path %s, got %s", expectedPath, r.URL.Path)
+		}
+		granted := []string{}
+		if r.Header.Get("Authorization") == "Bearer admin" {
+			granted = append(granted, AdminPermission)
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"permissions": granted})
+	}))
+	defer fake.Close()
+	SetIAMEndpoint(fake.URL)
+	defer SetIAMEndpoint("https://run.googleapis.com")
+
+	handler := RequireIAMPermission(AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"missing permission", "Bearer viewer", http.StatusForbidden},
+		{"granted permission", "Bearer admin", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.expected {
+				t.Fatalf("expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireIAMPermissionLocal(t *testing.T) {
+	t.Setenv("K_SERVICE", "")
+	t.Setenv("CLOUD_RUN_JOB", "")
+	ResetCache()
+	defer ResetCache()
+	defer SetIAMLocalBypass(false)
+
+	handler := RequireIAMPermission(AdminPermission, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+		return w.Code
+	}
+
+	if got := serve(); got != http.StatusForbidden {
+		t.Fatalf("expected local callers to be rejected by default, got %d", got)
+	}
+	SetIAMLocalBypass(true)
+	if got := serve(); got != http.StatusOK {
+		t.Fatalf("expected local callers to be admitted with bypass, got %d", got)
+	}
+}
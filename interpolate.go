@@ -0,0 +1,177 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// configInterpolation enables the expansion of references in config values.
+var configInterpolation atomic.Bool
+
+// EnableConfigInterpolation enables the expansion of references to other keys
+// and built-in runtime values in config values read with GetConfig, e.g.
+// `${PROJECT_ID}-uploads-${REGION}`. It is disabled by default, so that
+// existing values containing `$`, e.g. passwords or templates, are read
+// unchanged.
+func EnableConfigInterpolation() {
+	configInterpolation.Store(true)
+}
+
+// builtinConfig provides the values of references which are not found in the
+// config store, e.g. `${PROJECT_ID}`.
+var builtinConfig = map[string]func() string{
+	"PROJECT_ID":            ProjectID,
+	"PROJECT_NUMBER":        ProjectNumber,
+	"REGION":                Region,
+	"SERVICE_NAME":          ServiceName,
+	"JOB_NAME":              JobName,
+	"REVISION":              Revision,
+	"INSTANCE_ID":           InstanceID,
+	"SERVICE_ACCOUNT_EMAIL": ServiceAccountEmail,
+}
+
+// interpolator expands references to other keys in config values:
+//
+//   - `${KEY}` is replaced by the value for the key, or by the built-in value
+//     of the same name if the key is not in the config store.
+//   - `${KEY:-fallback}` uses the fallback if the key is missing or empty.
+//   - `$$` is replaced by a literal `$`, e.g. `$${KEY}` yields `${KEY}`.
+//
+// Referenced values are expanded recursively. Secret values are taken
+// literally. Values are only expanded if enabled with
+// EnableConfigInterpolation.
+type interpolator struct {
+	lookup func(key string) (configEntry, bool)
+	// stack holds the keys being expanded to detect cycles.
+	stack []string
+}
+
+func newInterpolator(lookup func(key string) (configEntry, bool)) *interpolator {
+	return &interpolator{lookup: lookup}
+}
+
+// resolve expands the value of the entry for the key. The result is marked
+// secret if any referenced value is secret.
+func (in *interpolator) resolve(key string, entry configEntry) (configEntry, error) {
+	if !configInterpolation.Load() || entry.secret || isSecretReference(entry.value) {
+		return resolveConfigEntry(key, entry)
+	}
+	if !strings.Contains(entry.value, "$") {
+		return entry, nil
+	}
+	if slices.Contains(in.stack, key) {
+		cycle := slices.Concat(in.stack[slices.Index(in.stack, key):], []string{key})
+		return configEntry{}, fmt.Errorf("config interpolation cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+
+	in.stack = append(in.stack, key)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+
+	value, secret, err := in.expand(entry.value)
+	if err != nil {
+		return configEntry{}, fmt.Errorf("failed to interpolate config key '%s': %w", key, err)
+	}
+	entry.value = value
+	entry.secret = entry.secret || secret
+	return entry, nil
+}
+
+func (in *interpolator) expand(value string) (string, bool, error) {
+	var builder strings.Builder
+	secret := false
+	for {
+		i := strings.IndexByte(value, '$')
+		if i < 0 || i == len(value)-1 {
+			builder.WriteString(value)
+			return builder.String(), secret, nil
+		}
+		builder.WriteString(value[:i])
+		value = value[i:]
+
+		switch value[1] {
+		case '$':
+			builder.WriteByte('$')
+			value = value[2:]
+			continue
+		case '{':
+		default:
+			builder.WriteByte('$')
+			value = value[1:]
+			continue
+		}
+
+		end := closingBrace(value)
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated reference '%s'", value)
+		}
+		expression := value[2:end]
+		value = value[end+1:]
+
+		name, fallback, hasFallback := strings.Cut(expression, ":-")
+		if name == "" {
+			return "", false, fmt.Errorf("empty reference '${%s}'", expression)
+		}
+		resolved, ok, err := in.reference(name)
+		if err != nil {
+			return "", false, err
+		}
+		if hasFallback && (!ok || resolved.value == "") {
+			expanded, fallbackSecret, err := in.expand(fallback)
+			if err != nil {
+				return "", false, err
+			}
+			resolved = configEntry{value: expanded, secret: fallbackSecret}
+			ok = true
+		}
+		if !ok {
+			return "", false, fmt.Errorf("unresolved reference '${%s}'", name)
+		}
+		builder.WriteString(resolved.value)
+		secret = secret || resolved.secret
+	}
+}
+
+// reference resolves the key from the config store, falling back to the
+// built-in values.
+func (in *interpolator) reference(key string) (configEntry, bool, error) {
+	if entry, ok := in.lookup(key); ok {
+		entry, err := in.resolve(key, entry)
+		return entry, err == nil, err
+	}
+	if builtin, ok := builtinConfig[key]; ok {
+		return configEntry{value: builtin()}, true, nil
+	}
+	return configEntry{}, false, nil
+}
+
+// closingBrace returns the index of the brace closing the reference at the
+// start of value, taking nested references in fallbacks into account.
+func closingBrace(value string) int {
+	depth := 0
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,148 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigInterpolation(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	ResetCache()
+	defer ResetCache()
+	this.projectID = "my-project"
+	this.region = "europe-west1"
+	EnableConfigInterpolation()
+	defer configInterpolation.Store(false)
+
+	PutConfig("BUCKET", "${PROJECT_ID}-uploads-${REGION}")
+	PutConfig("ENV", "prod")
+	PutConfig("EMPTY", "")
+	PutConfig("PREFIX", "${ENV}/${BUCKET}")
+	PutConfig("FALLBACK", "${MISSING:-${EMPTY:-default}}")
+	PutConfig("ESCAPED", "$${ENV} costs $5 or $$5")
+	PutConfig("OVERRIDE", "${REGION}")
+	PutConfig("UNRESOLVED", "${ENV}-${MISSING}")
+	PutConfig("UNTERMINATED", "${ENV")
+	PutConfig("A", "${B}")
+	PutConfig("B", "x${A}")
+
+	tests := []struct {
+		key      string
+		expected string
+		err      string
+	}{
+		{"BUCKET", "my-project-uploads-europe-west1", ""},
+		{"PREFIX", "prod/my-project-uploads-europe-west1", ""},
+		{"FALLBACK", "default", ""},
+		{"ESCAPED", "${ENV} costs $5 or $5", ""},
+		{"UNRESOLVED", "", "failed to interpolate config key 'UNRESOLVED': unresolved reference '${MISSING}'"},
+		{"UNTERMINATED", "", "failed to interpolate config key 'UNTERMINATED': unterminated reference '${ENV'"},
+		{"A", "", "failed to interpolate config key 'A': failed to interpolate config key 'B': config interpolation cycle detected: A -> B -> A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := GetConfig(tt.key)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %q, %v", tt.err, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	PutConfig("REGION", "us-central1")
+	if got, _ := GetConfig("OVERRIDE"); got != "us-central1" {
+		t.Fatalf("expected config key to take precedence over built-in, got %q", got)
+	}
+
+	PutConfig("PASSWORD", "pa$${x}")
+	_ = MarkConfigSecret("PASSWORD")
+	PutConfig("DSN", "user:${PASSWORD}@host")
+	entry, err := getConfigEntry("DSN")
+	if err != nil || entry.value != "user:pa$${x}@host" || !entry.secret {
+		t.Fatalf("expected literal secret and secret result, got %+v, %v", entry, err)
+	}
+}
+
+func TestConfigInterpolationDisabled(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	values := []string{
+		"ab$$cd",
+		"Hello ${name}",
+		"${PROJECT_ID}",
+		"${unterminated",
+		"$5 or $",
+	}
+	for _, value := range values {
+		PutConfig("key", value)
+		got, err := GetConfig("key")
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", value, err)
+		}
+		if got != value {
+			t.Fatalf("expected %q to pass through unchanged, got %q", value, got)
+		}
+		if got, _ := ConfigSnapshot().Get("key"); got != value {
+			t.Fatalf("expected %q to pass through snapshot unchanged, got %q", value, got)
+		}
+	}
+}
+
+func TestConfigInterpolationScoped(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	EnableConfigInterpolation()
+	defer configInterpolation.Store(false)
+
+	PutConfig("db.host", "h")
+	PutConfig("db.url", "${db.host}:5432")
+	PutConfig("ENV", "prod")
+	PutConfig("db.name", "app-${ENV}")
+
+	snapshot := ConfigPrefix("db.").Snapshot()
+	tests := map[string]string{
+		"url":  "h:5432",
+		"name": "app-prod",
+	}
+	for key, expected := range tests {
+		expectedGlobal, err := GetConfig("db." + key)
+		if err != nil || expectedGlobal != expected {
+			t.Fatalf("expected %q for 'db.%s', got %q (%v)", expected, key, expectedGlobal, err)
+		}
+		got, err := snapshot.Get(key)
+		if err != nil {
+			t.Fatalf("unexpected error for '%s': %v", key, err)
+		}
+		if got != expected {
+			t.Fatalf("expected %q for '%s', got %q", expected, key, got)
+		}
+	}
+	if keys := snapshot.Keys(); fmt.Sprint(keys) != "[host name url]" {
+		t.Fatalf("expected relative keys of the scope, got %v", keys)
+	}
+	if snapshot.Has("ENV") || snapshot.Len() != 3 {
+		t.Fatalf("expected snapshot to be scoped, got %v", snapshot.List())
+	}
+}
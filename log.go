@@ -13,14 +13,46 @@
 package run
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	// LogFormatEnv is the environment variable that overrides the log format.
+	// Set it to `json` to emit Cloud Logging JSON when running locally or to
+	// `text` to always emit the human-friendly format.
+	LogFormatEnv = "RUN_LOG_FORMAT"
+
+	localTimeFormat = "15:04:05.000"
+)
+
+var (
+	fatalExitCode        = 1
+	fatalShutdownTimeout = 5 * time.Second
+	exit                 = os.Exit
+)
+
+// SetFatalExitCode configures the exit code used by Fatal to terminate the
+// process. Defaults to 1, which marks the task of a Cloud Run job as failed.
+func SetFatalExitCode(code int) {
+	fatalExitCode = code
+}
+
+// SetFatalShutdownTimeout configures the deadline for shutdown hooks executed
+// by Fatal before the process exits. Defaults to 5 seconds.
+func SetFatalShutdownTimeout(timeout time.Duration) {
+	fatalShutdownTimeout = timeout
+}
+
 // LogEntry is the structured version of a single log entry intended to be
 // stored in Google Cloud Logging in JSON-serialized form.
 type LogEntry struct {
@@ -34,6 +66,12 @@ type LogEntry struct {
 	SourceLocation *SourceLocation `json:"logging.googleapis.com/sourceLocation,omitempty"`
 	// Component is the name of the service or job that produces the log entry.
 	Component string `json:"component,omitempty"`
+	// Operation groups related log entries of a long-running operation in
+	// Cloud Logging.
+	Operation *Operation `json:"logging.googleapis.com/operation,omitempty"`
+	// Time is the moment the log entry was created. Cloud Logging timestamps
+	// entries on ingestion, so it is only rendered in the local format.
+	Time time.Time `json:"-"`
 }
 
 // SourceLocation is the structured version of a location in the source code (at
@@ -45,10 +83,12 @@ type SourceLocation struct {
 	Line     string `json:"line,omitempty"`
 }
 
-// String returns a JSON representation of the log entry.
+// String returns a JSON representation of the log entry. When running locally
+// a human-friendly representation is returned instead, unless overridden by
+// the `RUN_LOG_FORMAT` environment variable.
 func (le LogEntry) String() string {
-	if Name() == "local" {
-		return fmt.Sprintf("%-10s %s", le.Severity, le.Message)
+	if useLocalLogFormat() {
+		return le.localString()
 	}
 	log.SetFlags(0)
 	jsonBytes, err := json.Marshal(le)
@@ -59,9 +99,60 @@ func (le LogEntry) String() string {
 	return string(jsonBytes)
 }
 
+// localString renders the log entry as a single, optionally colorized line:
+// time, severity, short source location, message and key=value fields.
+func (le LogEntry) localString() string {
+	timestamp := le.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	colors := useLogColors()
+	var b strings.Builder
+	b.WriteString(timestamp.Format(localTimeFormat))
+	b.WriteString(" ")
+	b.WriteString(colorize(fmt.Sprintf("%-9s", le.Severity), severityColor(le.Severity), colors))
+	if le.SourceLocation != nil && le.SourceLocation.File != "" {
+		location := fmt.Sprintf("%s:%s", filepath.Base(le.SourceLocation.File), le.SourceLocation.Line)
+		b.WriteString(" ")
+		b.WriteString(colorize(location, colorGray, colors))
+	}
+	b.WriteString(" ")
+	b.WriteString(le.Message)
+	for _, field := range le.fields() {
+		b.WriteString(" ")
+		b.WriteString(colorize(field[0]+"=", colorGray, colors))
+		b.WriteString(formatFieldValue(field[1]))
+	}
+	return b.String()
+}
+
+// fields returns the structured fields of the log entry as ordered key/value
+// pairs, omitting empty ones.
+func (le LogEntry) fields() [][2]string {
+	fields := [][2]string{}
+	if le.Component != "" {
+		fields = append(fields, [2]string{"component", le.Component})
+	}
+	if le.Trace != "" {
+		fields = append(fields, [2]string{"trace", le.Trace})
+	}
+	if le.Operation != nil {
+		fields = append(fields, [2]string{"operation", le.Operation.ID})
+	}
+	return fields
+}
+
+func formatFieldValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
 // Log logs a message
 func Log(r *http.Request, severity string, message string) {
-	logf(r, severity, message)
+	logf(r, severity, "%s", message)
 }
 
 // Logf logs a message with message interpolation/formatting
@@ -69,9 +160,21 @@ func Logf(r *http.Request, severity string, format string, v ...any) {
 	logf(r, severity, format, v...)
 }
 
+// LogContext logs a message enriched with the values attached to the context,
+// e.g. an operation started with StartOperation.
+func LogContext(ctx context.Context, severity string, message string) {
+	logWithContext(ctx, nil, 2, severity, "%s", message)
+}
+
+// LogContextf logs a message enriched with the values attached to the context
+// with message interpolation/formatting.
+func LogContextf(ctx context.Context, severity string, format string, v ...any) {
+	logWithContext(ctx, nil, 2, severity, format, v...)
+}
+
 // Default logs a message with DEFAULT severity
 func Default(r *http.Request, message string) {
-	logf(r, "DEFAULT", message)
+	logf(r, "DEFAULT", "%s", message)
 }
 
 // Defaultf logs a message with DEFAULT severity and message
@@ -82,7 +185,7 @@ func Defaultf(r *http.Request, format string, v ...any) {
 
 // Debug logs a message with DEBUG severity
 func Debug(r *http.Request, message string) {
-	logf(r, "DEBUG", message)
+	logf(r, "DEBUG", "%s", message)
 }
 
 // Debugf logs a message with DEBUG severity and message
@@ -93,7 +196,7 @@ func Debugf(r *http.Request, format string, v ...any) {
 
 // Info logs a message with INFO severity
 func Info(r *http.Request, message string) {
-	logf(r, "INFO", message)
+	logf(r, "INFO", "%s", message)
 }
 
 // Infof logs a message with INFO severity and message
@@ -104,7 +207,7 @@ func Infof(r *http.Request, format string, v ...any) {
 
 // Notice logs a message with NOTICE severity
 func Notice(r *http.Request, message string) {
-	logf(r, "NOTICE", message)
+	logf(r, "NOTICE", "%s", message)
 }
 
 // Noticef logs a message with NOTICE severity and message
@@ -115,7 +218,7 @@ func Noticef(r *http.Request, format string, v ...any) {
 
 // Warning logs a message with WARNING severity
 func Warning(r *http.Request, message string) {
-	logf(r, "WARNING", message)
+	logf(r, "WARNING", "%s", message)
 }
 
 // Warningf logs a message with WARNING severity and message
@@ -126,12 +229,12 @@ func Warningf(r *http.Request, format string, v ...any) {
 
 // Error logs a message with ERROR severity
 func Error(r *http.Request, err error) {
-	logf(r, "ERROR", err.Error())
+	logf(r, "ERROR", "%s", err.Error())
 }
 
 // Critical logs a message with CRITICAL severity
 func Critical(r *http.Request, message string) {
-	logf(r, "CRITICAL", message)
+	logf(r, "CRITICAL", "%s", message)
 }
 
 // Criticalf logs a message with CRITICAL severity and message
@@ -142,7 +245,7 @@ func Criticalf(r *http.Request, format string, v ...any) {
 
 // Alert logs a message with ALERT severity
 func Alert(r *http.Request, message string) {
-	logf(r, "ALERT", message)
+	logf(r, "ALERT", "%s", message)
 }
 
 // Alertf logs a message with ALERT severity and message
@@ -153,7 +256,7 @@ func Alertf(r *http.Request, format string, v ...any) {
 
 // Emergency logs a message with EMERGENCY severity
 func Emergency(r *http.Request, message string) {
-	logf(r, "EMERGENCY", message)
+	logf(r, "EMERGENCY", "%s", message)
 }
 
 // Emergencyf logs a message with EMERGENCY severity and message
@@ -162,12 +265,54 @@ func Emergencyf(r *http.Request, format string, v ...any) {
 	logf(r, "EMERGENCY", format, v...)
 }
 
-// Fatal logs a message and terminates the process.
+// Fatal logs an error with CRITICAL severity, executes all registered
+// shutdown hooks within the configured deadline and terminates the process
+// with the configured exit code.
 func Fatal(r *http.Request, err error) {
-	log.Fatalf("fatal error: %v", err)
+	logf(r, "CRITICAL", "fatal error: %v", err)
+	terminate()
+}
+
+// Fatalf logs a message with CRITICAL severity and message
+// interpolation/formatting, executes all registered shutdown hooks within the
+// configured deadline and terminates the process with the configured exit
+// code.
+func Fatalf(r *http.Request, format string, v ...any) {
+	logf(r, "CRITICAL", format, v...)
+	terminate()
+}
+
+func terminate() {
+	ctx, cancel := context.WithTimeout(context.Background(), fatalShutdownTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		Shutdown(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logf(nil, "WARNING", "shutdown hooks did not complete in time: %v", ctx.Err())
+	}
+
+	exit(fatalExitCode)
 }
 
 func logf(r *http.Request, severity string, format string, v ...any) {
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+	logWithContext(ctx, r, 3, severity, format, v...)
+}
+
+// logWithContext writes a log entry enriched with the trace of the request and
+// the values attached to the context. The skip argument is the number of stack
+// frames to ascend to find the source location of the log statement.
+func logWithContext(ctx context.Context, r *http.Request, skip int, severity string, format string, v ...any) {
 	log.SetFlags(0)
 	if !isLogEntrySeverity(severity) {
 		// Defaulting to the default, duh
@@ -175,7 +320,7 @@ func logf(r *http.Request, severity string, format string, v ...any) {
 	}
 
 	location := &SourceLocation{}
-	caller, file, line, ok := runtime.Caller(2)
+	caller, file, line, ok := runtime.Caller(skip)
 	if ok {
 		location.File = file
 		location.Line = fmt.Sprintf("%d", line)
@@ -190,22 +335,56 @@ func logf(r *http.Request, severity string, format string, v ...any) {
 		SourceLocation: location,
 		Message:        message,
 		Component:      component,
+		Operation:      operationFromContext(ctx),
+		Time:           time.Now(),
 	}
 
-	if r == nil {
-		log.Println(le)
-		return
+	traceID, _ := TraceFromContext(ctx)
+	if traceID == "" && r != nil {
+		traceID = parseTraceID(
+			r.Header.Get("X-Cloud-Trace-Context"),
+			r.Header.Get("traceparent"),
+		)
 	}
-
-	traceHeader := r.Header.Get("X-Cloud-Trace-Context")
-	ts := strings.Split(traceHeader, "/")
-	if len(ts) > 0 && len(ts[0]) > 0 {
-		le.Trace = fmt.Sprintf("projects/%s/traces/%s", ProjectID(), ts[0])
+	if traceID != "" {
+		le.Trace = fmt.Sprintf("projects/%s/traces/%s", ProjectID(), traceID)
 	}
 
 	log.Println(le)
 }
 
+type traceKey struct{}
+
+// ContextWithTrace attaches a trace ID to the context, so that entries logged
+// with LogContext are correlated with the trace in Cloud Trace.
+func ContextWithTrace(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// TraceFromContext returns the trace ID attached to the context, if any.
+func TraceFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	traceID, ok := ctx.Value(traceKey{}).(string)
+	return traceID, ok && traceID != ""
+}
+
+// parseTraceID extracts the trace ID from the values of either the
+// `X-Cloud-Trace-Context` header (`TRACE_ID/SPAN_ID;o=OPTIONS`) or the W3C
+// `traceparent` header (`VERSION-TRACE_ID-SPAN_ID-FLAGS`).
+func parseTraceID(cloudTraceContext string, traceparent string) string {
+	traceID, _, _ := strings.Cut(cloudTraceContext, "/")
+	if traceID != "" {
+		return traceID
+	}
+	parts := strings.Split(traceparent, "-")
+	if len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+	return ""
+}
+
 func logEntrySeverities() []string {
 	// reference: https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#logseverity
 	return []string{
@@ -230,3 +409,72 @@ func isLogEntrySeverity(severity string) bool {
 	}
 	return false
 }
+
+const (
+	colorReset   = "\033[0m"
+	colorGray    = "\033[90m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorBlue    = "\033[34m"
+	colorMagenta = "\033[35m"
+	colorCyan    = "\033[36m"
+	colorBoldRed = "\033[1;31m"
+)
+
+func severityColor(severity string) string {
+	switch severity {
+	case "DEBUG":
+		return colorGray
+	case "INFO":
+		return colorGreen
+	case "NOTICE":
+		return colorCyan
+	case "WARNING":
+		return colorYellow
+	case "ERROR":
+		return colorRed
+	case "CRITICAL", "ALERT":
+		return colorMagenta
+	case "EMERGENCY", "FATAL":
+		return colorBoldRed
+	default:
+		return colorBlue
+	}
+}
+
+func colorize(text string, color string, enabled bool) string {
+	if !enabled {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// useLocalLogFormat reports whether log entries should be rendered in the
+// human-friendly local format instead of JSON.
+func useLocalLogFormat() bool {
+	switch strings.ToLower(os.Getenv(LogFormatEnv)) {
+	case "json":
+		return false
+	case "text":
+		return true
+	}
+	return Name() == "local"
+}
+
+// useLogColors reports whether the log output is an interactive terminal.
+// Colors can be disabled by setting `NO_COLOR`.
+func useLogColors() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	file, ok := log.Writer().(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
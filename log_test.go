@@ -0,0 +1,263 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer collects log output written concurrently by servers under test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// entries returns the JSON log entries written so far.
+func (b *logBuffer) entries(t *testing.T) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := []LogEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to parse log entry %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// captureLog redirects the standard logger to a buffer in JSON format until
+// the test completes.
+func captureLog(t *testing.T) *logBuffer {
+	t.Setenv(LogFormatEnv, "json")
+	buf := &logBuffer{}
+	writer := log.Writer()
+	log.SetOutput(buf)
+	t.Cleanup(func() {
+		log.SetOutput(writer)
+	})
+	return buf
+}
+
+// stubExit replaces the process exit with a function recording the exit
+// code until the test completes.
+func stubExit(t *testing.T) *int {
+	code := -1
+	exit = func(c int) {
+		code = c
+	}
+	t.Cleanup(func() {
+		exit = os.Exit
+	})
+	return &code
+}
+
+func TestFatal(t *testing.T) {
+	buf := captureLog(t)
+	code := stubExit(t)
+	SetFatalExitCode(3)
+	defer SetFatalExitCode(1)
+
+	var hooks []string
+	OnShutdown(func(context.Context) { hooks = append(hooks, "first") })
+	OnShutdown(func(context.Context) { hooks = append(hooks, "second") })
+
+	Fatal(nil, errors.New("boom"))
+
+	if *code != 3 {
+		t.Errorf("expected exit code 3, got %d", *code)
+	}
+	if strings.Join(hooks, ",") != "second,first" {
+		t.Errorf("expected hooks to run in reverse order, got %v", hooks)
+	}
+	entries := buf.entries(t)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d", len(entries))
+	}
+	if entries[0].Severity != "CRITICAL" || entries[0].Message != "fatal error: boom" {
+		t.Errorf("unexpected log entry %+v", entries[0])
+	}
+	if !strings.HasSuffix(entries[0].SourceLocation.File, "log_test.go") {
+		t.Errorf("expected source location in log_test.go, got %s", entries[0].SourceLocation.File)
+	}
+}
+
+func TestFatalShutdownTimeout(t *testing.T) {
+	buf := captureLog(t)
+	code := stubExit(t)
+	SetFatalShutdownTimeout(10 * time.Millisecond)
+	defer SetFatalShutdownTimeout(5 * time.Second)
+
+	release := make(chan struct{})
+	defer close(release)
+	OnShutdown(func(context.Context) {
+		<-release // Ignores the deadline
+	})
+
+	start := time.Now()
+	Fatalf(nil, "fatal %s", "error")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Fatalf to give up on the hook after the timeout, took %s", elapsed)
+	}
+
+	if *code != 1 {
+		t.Errorf("expected exit code 1, got %d", *code)
+	}
+	entries := buf.entries(t)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log entries, got %d", len(entries))
+	}
+	if entries[0].Severity != "CRITICAL" || entries[0].Message != "fatal error" {
+		t.Errorf("unexpected log entry %+v", entries[0])
+	}
+	if entries[1].Severity != "WARNING" || !strings.Contains(entries[1].Message, "did not complete in time") {
+		t.Errorf("unexpected log entry %+v", entries[1])
+	}
+}
+
+func TestLogEntryLocalString(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	timestamp := time.Date(2024, 5, 1, 13, 4, 5, 678000000, time.UTC)
+
+	tests := []struct {
+		name     string
+		entry    LogEntry
+		expected string
+	}{
+		{
+			name: "minimal",
+			entry: LogEntry{
+				Severity: "INFO",
+				Message:  "hello",
+				Time:     timestamp,
+			},
+			expected: "13:04:05.678 INFO      hello",
+		},
+		{
+			name: "all fields",
+			entry: LogEntry{
+				Severity:       "WARNING",
+				Message:        "disk almost full",
+				SourceLocation: &SourceLocation{File: "/src/app/main.go", Line: "42"},
+				Component:      "svc",
+				Trace:          "projects/my-project/traces/abc",
+				Operation:      &Operation{ID: "import-1"},
+				Time:           timestamp,
+			},
+			expected: "13:04:05.678 WARNING   main.go:42 disk almost full component=svc trace=projects/my-project/traces/abc operation=import-1",
+		},
+		{
+			name: "quoted field",
+			entry: LogEntry{
+				Severity:  "DEBUG",
+				Message:   "hello",
+				Component: "my svc",
+				Time:      timestamp,
+			},
+			expected: `13:04:05.678 DEBUG     hello component="my svc"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := test.entry.localString(); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLogEntryLocalStringColors(t *testing.T) {
+	entry := LogEntry{Severity: "ERROR", Message: "hello"}
+	if colored := colorize("ERROR", severityColor("ERROR"), true); colored != colorRed+"ERROR"+colorReset {
+		t.Errorf("expected red severity, got %q", colored)
+	}
+
+	// Colors are disabled for output other than terminals.
+	writer := log.Writer()
+	defer log.SetOutput(writer)
+	log.SetOutput(&logBuffer{})
+	if strings.Contains(entry.localString(), "\033[") {
+		t.Errorf("expected no colors, got %q", entry.localString())
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	entry := LogEntry{Severity: "INFO", Message: "hello", Component: "svc"}
+
+	tests := []struct {
+		name     string
+		service  string
+		format   string
+		expected string
+	}{
+		{name: "local default", format: "", expected: "text"},
+		{name: "service default", service: "svc", format: "", expected: "json"},
+		{name: "local json", format: "json", expected: "json"},
+		{name: "service text", service: "svc", format: "TEXT", expected: "text"},
+		{name: "invalid", service: "svc", format: "yaml", expected: "json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ResetCache()
+			defer ResetCache()
+			t.Setenv("K_SERVICE", test.service)
+			t.Setenv(LogFormatEnv, test.format)
+
+			actual := entry.String()
+			switch test.expected {
+			case "json":
+				expected := `{"message":"hello","severity":"INFO","component":"svc"}`
+				if actual != expected {
+					t.Errorf("expected %s, got %s", expected, actual)
+				}
+			case "text":
+				if !strings.HasSuffix(actual, "hello component=svc") || strings.HasPrefix(actual, "{") {
+					t.Errorf("expected local format, got %s", actual)
+				}
+			}
+		})
+	}
+}
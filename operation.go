@@ -0,0 +1,95 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Operation is the structured version of a long-running operation which
+// groups related log entries in Google Cloud Logging. It is intended to be
+// embedded in a run.LogEntry in JSON-serialized form.
+type Operation struct {
+	// ID is the unique identifier of the operation.
+	ID string `json:"id,omitempty"`
+	// Producer identifies the producer of the operation, together with the ID
+	// it uniquely identifies the operation.
+	Producer string `json:"producer,omitempty"`
+	// First is set on the first log entry of the operation.
+	First bool `json:"first,omitempty"`
+	// Last is set on the last log entry of the operation.
+	Last bool `json:"last,omitempty"`
+}
+
+type operationKey struct{}
+
+// StartOperation starts a new named operation, logs its first entry and
+// returns a context which tags all log entries written with LogContext with
+// the operation. The returned func logs the last entry of the operation and
+// should be called once the operation is done.
+//
+//	ctx, end := run.StartOperation(ctx, "import")
+//	defer end()
+func StartOperation(ctx context.Context, name string) (context.Context, func()) {
+	operation := Operation{
+		ID:       fmt.Sprintf("%s-%s", name, operationID()),
+		Producer: fmt.Sprintf("%s/%s", Name(), name),
+	}
+	ctx = context.WithValue(ctx, operationKey{}, operation)
+	start := time.Now()
+
+	first := operation
+	first.First = true
+	logWithContext(context.WithValue(ctx, operationKey{}, first), nil, 2,
+		"INFO", "operation started: %s", name)
+
+	return ctx, func() {
+		last := operation
+		last.Last = true
+		logWithContext(context.WithValue(ctx, operationKey{}, last), nil, 2,
+			"INFO", "operation completed: %s (took %s)", name, time.Since(start))
+	}
+}
+
+// OperationFromContext returns the operation attached to the context by
+// StartOperation, if any.
+func OperationFromContext(ctx context.Context) (Operation, bool) {
+	operation := operationFromContext(ctx)
+	if operation == nil {
+		return Operation{}, false
+	}
+	return *operation, true
+}
+
+func operationFromContext(ctx context.Context) *Operation {
+	if ctx == nil {
+		return nil
+	}
+	operation, ok := ctx.Value(operationKey{}).(Operation)
+	if !ok {
+		return nil
+	}
+	return &operation
+}
+
+func operationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
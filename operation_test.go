@@ -0,0 +1,72 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStartOperation(t *testing.T) {
+	ResetCache()
+	defer ResetCache()
+	t.Setenv("K_SERVICE", "svc")
+	buf := captureLog(t)
+
+	ctx, end := StartOperation(context.Background(), "import")
+	LogContext(ctx, "INFO", "importing")
+	end()
+
+	operation, ok := OperationFromContext(ctx)
+	if !ok {
+		t.Fatal("expected operation attached to context")
+	}
+	if !strings.HasPrefix(operation.ID, "import-") || operation.Producer != "svc/import" {
+		t.Errorf("unexpected operation %+v", operation)
+	}
+
+	expected := []map[string]any{
+		{"id": operation.ID, "producer": "svc/import", "first": true},
+		{"id": operation.ID, "producer": "svc/import"},
+		{"id": operation.ID, "producer": "svc/import", "last": true},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d log entries, got %d", len(expected), len(lines))
+	}
+	for i, line := range lines {
+		var entry map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to parse log entry %q: %v", line, err)
+		}
+		var actual map[string]any
+		if err := json.Unmarshal(entry["logging.googleapis.com/operation"], &actual); err != nil {
+			t.Fatalf("failed to parse operation of %q: %v", line, err)
+		}
+		if len(actual) != len(expected[i]) {
+			t.Errorf("entry %d: expected operation %v, got %v", i, expected[i], actual)
+			continue
+		}
+		for key, value := range expected[i] {
+			if actual[key] != value {
+				t.Errorf("entry %d: expected %s=%v, got %v", i, key, value, actual[key])
+			}
+		}
+	}
+
+	if _, ok := OperationFromContext(context.Background()); ok {
+		t.Error("expected no operation attached to background context")
+	}
+}
@@ -51,6 +51,7 @@ type cache struct {
 	jobTaskAttempt      int
 	jobTaskCount        int
 	knativeService      *knative.Service
+	serviceConfig       *ServiceConfig
 }
 
 var this cache // NOTE: acts as cache
@@ -389,345 +390,125 @@ func KNativeService() (knative.Service, error) {
 }
 
 func Creator() (string, error) {
-	annotationKey := "serving.knative.dev/creator"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("serving.knative.dev/creator")
 }
 
 func LastModifier() (string, error) {
-	annotationKey := "serving.knative.dev/lastModifier"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("serving.knative.dev/lastModifier")
 }
 
 func LaunchStage() (string, error) {
-	annotationKey := "run.googleapis.com/launch-stage"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/launch-stage")
 }
 
 func Description() (string, error) {
-	annotationKey := "run.googleapis.com/description"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/description")
 }
 
 func Ingress() (string, error) {
-	annotationKey := "run.googleapis.com/ingress"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/ingress")
 }
 
 func BinaryAuthorizationPolicy() (string, error) {
-	annotationKey := "run.googleapis.com/binary-authorization"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/binary-authorization")
 }
 
 // BinaryAuthorizationBreakglassJustification returns the justification for
 // circumventing the configured Binary Authorization policy.
 func BinaryAuthorizationBreakglassJustification() (string, error) {
-	annotationKey := "run.googleapis.com/binary-authorization-breakglass"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/binary-authorization-breakglass")
 }
 
 func ServiceMinimumInstances() (int, error) {
-	annotationKey := "run.googleapis.com/minScale"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return 0, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return 0, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.Atoi(annotationValue)
+	return Annotation[int]("run.googleapis.com/minScale")
 }
 
 func FunctionEntryPoint() (string, error) {
-	annotationKey := "run.googleapis.com/function-target"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/function-target")
 }
 
 func InvokerIAMDisabled() (bool, error) {
-	annotationKey := "run.googleapis.com/invoker-iam-disabled"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return false, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return false, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.ParseBool(annotationValue)
+	return Annotation[bool]("run.googleapis.com/invoker-iam-disabled")
 }
 
 func IAPEnabled() (bool, error) {
-	annotationKey := "run.googleapis.com/iap-enabled"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return false, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return false, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.ParseBool(annotationValue)
+	return Annotation[bool]("run.googleapis.com/iap-enabled")
 }
 
 func ScalingMode() (string, error) {
-	annotationKey := "run.googleapis.com/scalingMode"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/scalingMode")
 }
 
 func ManualInstances() (int, error) {
-	annotationKey := "run.googleapis.com/manualInstanceCount"
-	knativeService, err := KNativeService()
+	instances, err := Annotation[int]("run.googleapis.com/manualInstanceCount")
 	if err != nil {
-		return -1, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
+		return -1, err
 	}
-	annotationValue := knativeService.Annotations[annotationKey]
-	if annotationValue == "" {
-		return -1, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.Atoi(annotationValue)
+	return instances, nil
 }
 
 func RevisionMinimumInstances() (int, error) {
-	annotationKey := "autoscaling.knative.dev/minScale"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return 0, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return 0, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.Atoi(annotationValue)
+	return Annotation[int]("autoscaling.knative.dev/minScale")
 }
 
 func RevisionMaximumInstances() (int, error) {
-	annotationKey := "autoscaling.knative.dev/maxScale"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return 0, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return 0, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.Atoi(annotationValue)
+	return Annotation[int]("autoscaling.knative.dev/maxScale")
 }
 
 func CPUThrottling() (bool, error) {
-	annotationKey := "run.googleapis.com/cpu-throttling"
-	knativeService, err := KNativeService()
+	throttling, err := Annotation[bool]("run.googleapis.com/cpu-throttling")
 	if err != nil {
-		return true, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return true, fmt.Errorf("error reading property '%s'", annotationKey)
+		return true, err
 	}
-
-	return strconv.ParseBool(annotationValue)
+	return throttling, nil
 }
 
 func StartupCPUBoost() (bool, error) {
-	annotationKey := "run.googleapis.com/cpu-throttling"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return false, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return false, fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return strconv.ParseBool(annotationValue)
+	return Annotation[bool]("run.googleapis.com/startup-cpu-boost")
 }
 
 func SessionAffinity() (string, error) {
-	annotationKey := "run.googleapis.com/SessionAffinity"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/sessionAffinity")
 }
 
 func CloudSQLInstances() ([]string, error) {
-	annotationKey := "run.googleapis.com/cloudsql-instances"
-	knativeService, err := KNativeService()
+	instances, err := Annotation[[]string]("run.googleapis.com/cloudsql-instances")
 	if err != nil {
-		return []string{}, fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return []string{}, fmt.Errorf("error reading property '%s'", annotationKey)
+		return []string{}, err
 	}
-
-	return strings.Split(annotationValue, ","), nil
+	return instances, nil
 }
 
 func ExecutionEnvironment() (string, error) {
-	annotationKey := "run.googleapis.com/execution-environment"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/execution-environment")
 }
 
 func VPCAccessConnector() (string, error) {
-	annotationKey := "run.googleapis.com/vpc-access-connector"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/vpc-access-connector")
 }
 
 func VPCAccessEgress() (string, error) {
-	annotationKey := "run.googleapis.com/vpc-access-egress"
-	knativeService, err := KNativeService()
+	egress, err := Annotation[string]("run.googleapis.com/vpc-access-egress")
 	if err != nil {
-		return "all-traffic", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "all-traffic", fmt.Errorf("error reading property '%s'", annotationKey)
+		return "all-traffic", err
 	}
+	return normalizeVPCAccessEgress(egress), nil
+}
 
-	if annotationValue == "all" {
-		return "all-traffic", nil
+// normalizeVPCAccessEgress maps the legacy value `all` to `all-traffic`.
+func normalizeVPCAccessEgress(egress string) string {
+	if egress == "all" {
+		return "all-traffic"
 	}
-
-	return annotationValue, nil
+	return egress
 }
 
 func VPCNetworkInterfaces() (string, error) {
-	annotationKey := "run.googleapis.com/network-interfaces"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/network-interfaces")
 }
 
 func EncryptionKey() (string, error) {
-	annotationKey := "run.googleapis.com/encryption-key"
-	knativeService, err := KNativeService()
-	if err != nil {
-		return "", fmt.Errorf("error loading property '%s': %v", annotationKey, err)
-	}
-	annotationValue := knativeService.Spec.Template.Annotations[annotationKey]
-	if annotationValue == "" {
-		return "", fmt.Errorf("error reading property '%s'", annotationKey)
-	}
-
-	return annotationValue, nil
+	return Annotation[string]("run.googleapis.com/encryption-key")
 }
 
 func loadKNativeService() error {
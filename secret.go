@@ -0,0 +1,162 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretReferencePrefix marks config values which refer to a secret version
+// in Secret Manager.
+const secretReferencePrefix = "sm://"
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+var (
+	secretManagerEndpoint = "https://secretmanager.googleapis.com"
+	secretCacheTTL        = 5 * time.Minute
+	secretCache           = make(map[string]cachedSecret)
+	secretMu              sync.Mutex
+)
+
+// SetSecretManagerEndpoint configures the Secret Manager API endpoint used to
+// resolve secret references, e.g. to point to a local fake server in tests.
+func SetSecretManagerEndpoint(endpoint string) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretManagerEndpoint = strings.TrimSuffix(endpoint, "/")
+}
+
+// SetSecretCacheTTL configures how long resolved secret references are cached.
+// Defaults to 5 minutes.
+func SetSecretCacheTTL(ttl time.Duration) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretCacheTTL = ttl
+}
+
+// ResetSecretCache deletes all cached secrets.
+func ResetSecretCache() {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretCache = make(map[string]cachedSecret)
+}
+
+func isSecretReference(val string) bool {
+	return strings.HasPrefix(val, secretReferencePrefix)
+}
+
+// secretVersionName expands a secret reference into the full resource name of
+// the secret version. Supported forms are:
+//
+//	sm://projects/PROJECT/secrets/SECRET/versions/VERSION
+//	sm://projects/PROJECT/secrets/SECRET
+//	sm://SECRET
+//
+// The project defaults to ProjectID() and the version to `latest`.
+func secretVersionName(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, secretReferencePrefix)
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return fmt.Sprintf("projects/%s/secrets/%s/versions/latest", ProjectID(), parts[0]), nil
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets":
+		return name + "/versions/latest", nil
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions":
+		return name, nil
+	}
+	return "", fmt.Errorf("malformed secret reference: '%s'", ref)
+}
+
+// resolveSecretReference returns the payload of the referenced secret version
+// from the cache or Secret Manager.
+func resolveSecretReference(ref string) (string, error) {
+	name, err := secretVersionName(ref)
+	if err != nil {
+		return "", err
+	}
+
+	secretMu.Lock()
+	cached, ok := secretCache[name]
+	endpoint := secretManagerEndpoint
+	ttl := secretCacheTTL
+	secretMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	value, err := accessSecretVersion(endpoint, name)
+	if err != nil {
+		return "", err
+	}
+
+	secretMu.Lock()
+	secretCache[name] = cachedSecret{value, time.Now().Add(ttl)}
+	secretMu.Unlock()
+	return value, nil
+}
+
+func accessSecretVersion(endpoint string, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/v1/%s:access", endpoint, name)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	request = AddOAuth2Header(request)
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to access secret version '%s': %s", name, resp.Status)
+	}
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return "", err
+	}
+	if result.Payload.Data == "" {
+		return "", errors.New("secret version has no payload")
+	}
+	payload, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
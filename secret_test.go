@@ -0,0 +1,85 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSecretReferences(t *testing.T) {
+	ResetConfig()
+	ResetSecretCache()
+	defer ResetConfig()
+	defer ResetSecretCache()
+
+	var requests atomic.Int64
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer local-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/projects/p/secrets/db-pass/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"payload": map[string]string{
+				"data": base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+			},
+		})
+	}))
+	defer fake.Close()
+	SetSecretManagerEndpoint(fake.URL)
+	defer SetSecretManagerEndpoint("https://secretmanager.googleapis.com")
+	SetSecretCacheTTL(time.Minute)
+	defer SetSecretCacheTTL(5 * time.Minute)
+
+	PutConfig("db.password", "sm://projects/p/secrets/db-pass/versions/latest")
+	PutConfig("db.short", "sm://projects/p/secrets/db-pass")
+	PutConfig("missing", "sm://projects/p/secrets/missing/versions/1")
+	PutConfig("malformed", "sm://projects/p")
+
+	for _, key := range []string{"db.password", "db.short", "db.password"} {
+		val, err := GetConfig(key)
+		if err != nil {
+			t.Fatalf("failed to resolve %s: %v", key, err)
+		}
+		if val != "s3cr3t" {
+			t.Fatalf("expected resolved secret, got %q", val)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("expected resolved secret to be cached, got %d requests", got)
+	}
+
+	if !IsSecretConfig("db.password") {
+		t.Fatal("expected secret reference to be marked secret")
+	}
+	if listing := ListConfig(); strings.Contains(listing["db.password"], "s3cr3t") {
+		t.Fatalf("expected listing not to contain secret, got %v", listing)
+	}
+
+	for _, key := range []string{"missing", "malformed"} {
+		if _, err := GetConfig(key); err == nil {
+			t.Fatalf("expected error resolving %s", key)
+		}
+	}
+}
@@ -14,29 +14,244 @@ package run
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
 	http2 "golang.org/x/net/http2"
 	http2clear "golang.org/x/net/http2/h2c"
 	grpc "google.golang.org/grpc"
+	health "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
+const (
+	// healthCheckInterval is the interval in which the GRPC health service is
+	// updated with the health of registered clients.
+	healthCheckInterval = 10 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	// serveShutdownTimeout is the deadline for shutting down servers, which
+	// matches the 10 seconds Cloud Run grants after sending SIGTERM.
+	serveShutdownTimeout = 10 * time.Second
+)
+
+var (
+	shutdownHooks   []func(context.Context)
+	shutdownHooksMu sync.Mutex
+)
+
+// OnShutdown registers a hook to be executed by Shutdown, i.e. when a server
+// started with ServeHTTP or ServeGRPC terminates or when Fatal is called.
+// Hooks should respect the deadline of the supplied context.
+func OnShutdown(hook func(context.Context)) {
+	if hook == nil {
+		return
+	}
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+// Shutdown executes all registered shutdown hooks in reverse registration
+// order and closes all initialized clients afterwards. Hooks are only executed
+// once, subsequent calls are no-ops unless new hooks are registered.
+//
+// Cloud Run jobs should call Shutdown before exiting.
+func Shutdown(ctx context.Context) {
+	shutdownHooksMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownHooksMu.Unlock()
+
+	for _, hook := range slices.Backward(hooks) {
+		hook(ctx)
+	}
+
+	_ = CloseClients(ctx)
+}
+
+// ServeOption configures the behaviour of ServeHTTP and ServeGRPC.
+type ServeOption func(*serveConfig)
+
+type serveConfig struct {
+	warmClients     bool
+	warmClientNames []string
+	logConfig       bool
+	handlers        map[string]http.Handler
+}
+
+// ServeWarmClients initializes the named lazy clients, or all registered lazy
+// clients if no names are supplied, concurrently before the server starts
+// listening. This moves initialization latency out of the first requests and
+// into the startup phase, which benefits from startup CPU boost.
+//
+// Failed initializations are logged and retried on first use of the client.
+func ServeWarmClients(names ...string) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.warmClients = true
+		cfg.warmClientNames = names
+	}
+}
+
+// ServeClientsAdmin mounts ClientsHandler at the given path of the default
+// mux used by ServeHTTP. Access requires the AdminPermission on this service.
+func ServeClientsAdmin(path string) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.handlers[path] = RequireIAMPermission(AdminPermission, ClientsHandler())
+	}
+}
+
+// ServeConfigAdmin mounts ConfigHandler at the given path of the default mux
+// used by ServeHTTP. Access requires the ConfigAdminPermission on this
+// service.
+func ServeConfigAdmin(path string) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.handlers[path] = RequireIAMPermission(ConfigAdminPermission, ConfigHandler())
+	}
+}
+
+// ServeLogConfig logs the redacted config and its drift to the declared
+// environment before the server starts listening, see LogConfig.
+func ServeLogConfig() ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.logConfig = true
+	}
+}
+
+// ClientsHandler returns an HTTP handler which lists all registered clients
+// as JSON, see DescribeClients.
+func ClientsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DescribeClients()); err != nil {
+			Error(r, err)
+		}
+	})
+}
+
+func newServeConfig(opts []ServeOption) *serveConfig {
+	cfg := &serveConfig{
+		handlers: make(map[string]http.Handler),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// startup executes all configured startup tasks before the server listens.
+func (cfg *serveConfig) startup() {
+	if cfg.logConfig {
+		LogConfig()
+	}
+	if cfg.warmClients {
+		warmClients(cfg.warmClientNames)
+	}
+}
+
+func warmClients(names []string) {
+	report, _ := WarmClients(context.Background(), names...)
+	for _, warmup := range report {
+		if warmup.Err != nil {
+			Warningf(nil, "failed to warm client '%s' after %s: %v", warmup.Name, warmup.Duration, warmup.Err)
+			continue
+		}
+		Infof(nil, "warmed client '%s' in %s", warmup.Name, warmup.Duration)
+	}
+}
+
+// ReadinessHandler returns an HTTP handler which responds with `200 OK` if all
+// registered clients pass their health checks and with
+// `503 Service Unavailable` otherwise. ServeHTTP mounts it at `/readyz` when
+// using the default mux.
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		healthy, err := ClientsHealthy(ctx)
+		if !healthy {
+			Warningf(r, "readiness check failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("NOT READY"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+}
+
+// serveGRPCHealth registers the standard GRPC health service with the server,
+// unless one is registered already, and keeps the serving status in sync with
+// the health of registered clients until the context is done.
+func serveGRPCHealth(ctx context.Context, server *grpc.Server) {
+	if _, ok := server.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		return
+	}
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	update := func() {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		status := healthpb.HealthCheckResponse_SERVING
+		if healthy, err := ClientsHealthy(checkCtx); !healthy {
+			Warningf(nil, "health check failed: %v", err)
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		healthServer.SetServingStatus("", status)
+	}
+
+	update()
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				healthServer.Shutdown()
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
+
 // ServeGRPC starts the GRPC server, listens and serves requests
 //
 // It also traps SIGINT and SIGTERM. Both signals will cause a graceful
 // shutdown of the GRPC server and executes the user supplied
-// shutdown func.
-func ServeGRPC(shutdown func(context.Context), server *grpc.Server) error {
+// shutdown func and all hooks registered with OnShutdown before closing all
+// initialized clients.
+// If the server fails to listen or serve, the shutdown func, hooks and
+// clients are shut down likewise before the error is returned.
+//
+// Servers created with NewGRPCServer log every RPC and correlate logs with
+// the trace of the incoming request, a warning is logged for servers created
+// otherwise. Unless the server already provides one, the standard GRPC health
+// service is registered, reporting the health of registered clients.
+func ServeGRPC(shutdown func(context.Context), server *grpc.Server, opts ...ServeOption) error {
 	if server == nil {
 		return errors.New("cannot listen using ni GRPC server")
 	}
+	if !isInterceptedGRPCServer(server) {
+		Warning(nil, "GRPC server was not created with run.NewGRPCServer, RPCs are neither logged nor traced")
+	}
+	OnShutdown(shutdown)
+	newServeConfig(opts).startup()
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	serveGRPCHealth(healthCtx, server)
 
 	errChan := make(chan error, 1)
 	sigChan := make(chan os.Signal, 1)
@@ -45,7 +260,8 @@ func ServeGRPC(shutdown func(context.Context), server *grpc.Server) error {
 	go func(errChan chan<- error) {
 		listener, err := net.Listen("tcp", net.JoinHostPort("0.0.0.0", Port()))
 		if err != nil {
-			log.Fatalf("failed to listen: %v", err)
+			errChan <- fmt.Errorf("failed to listen: %w", err)
+			return
 		}
 
 		if err := server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
@@ -56,22 +272,21 @@ func ServeGRPC(shutdown func(context.Context), server *grpc.Server) error {
 
 	select {
 	case err := <-errChan:
+		shutdownAfterError(err)
 		return err
 	case sig := <-sigChan:
 		Noticef(nil, "shutdown initiated by signal: %v", sig)
 	}
 
-	// Cloud Run 10 sec time out
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
 	defer cancel()
 
 	// Gracefully shutdown the http server by waiting on existing requests
+	stopHealth()
 	server.Stop()
 
-	// User-supplied shutdown
-	if shutdown != nil {
-		shutdown(ctx)
-	}
+	// User-supplied shutdown and registered hooks
+	Shutdown(ctx)
 
 	Info(nil, "shutdown complete")
 	return nil
@@ -81,8 +296,17 @@ func ServeGRPC(shutdown func(context.Context), server *grpc.Server) error {
 //
 // It also traps SIGINT and SIGTERM. Both signals will cause a graceful
 // shutdown of the HTTP server and executes the user supplied
-// shutdown func.
-func ServeHTTP(shutdown func(context.Context), server *http.Server) error {
+// shutdown func and all hooks registered with OnShutdown before closing all
+// initialized clients.
+// If the server fails to listen or serve, the shutdown func, hooks and
+// clients are shut down likewise before the error is returned.
+func ServeHTTP(shutdown func(context.Context), server *http.Server, opts ...ServeOption) error {
+	OnShutdown(shutdown)
+	cfg := newServeConfig(opts)
+	cfg.startup()
+	if server != nil && len(cfg.handlers) > 0 {
+		Warning(nil, "admin handlers are only mounted on the default mux")
+	}
 	if server == nil {
 		mux := http.DefaultServeMux
 		// Add default uptime check handler
@@ -90,6 +314,12 @@ func ServeHTTP(shutdown func(context.Context), server *http.Server) error {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("OK"))
 		})
+		// Add default readiness check handler
+		mux.Handle("GET /readyz", ReadinessHandler())
+		// Add opt-in admin handlers
+		for path, handler := range cfg.handlers {
+			mux.Handle("GET "+path, handler)
+		}
 		server = &http.Server{
 			Addr: net.JoinHostPort("0.0.0.0", Port()),
 			// Support HTTP2
@@ -110,13 +340,13 @@ func ServeHTTP(shutdown func(context.Context), server *http.Server) error {
 
 	select {
 	case err := <-errChan:
+		shutdownAfterError(err)
 		return err
 	case sig := <-sigChan:
 		Noticef(nil, "shutdown initiated by signal: %v", sig)
 	}
 
-	// Cloud Run 10 sec time out
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
 	defer cancel()
 
 	// Gracefully shutdown the http server by waiting on existing requests
@@ -124,11 +354,18 @@ func ServeHTTP(shutdown func(context.Context), server *http.Server) error {
 		Fatal(nil, err)
 	}
 
-	// User-supplied shutdown
-	if shutdown != nil {
-		shutdown(ctx)
-	}
+	// User-supplied shutdown and registered hooks
+	Shutdown(ctx)
 
 	Info(nil, "shutdown complete")
 	return nil
 }
+
+// shutdownAfterError executes the shutdown hooks and closes all clients after
+// a server failed to listen or serve.
+func shutdownAfterError(err error) {
+	Error(nil, fmt.Errorf("shutdown initiated by server error: %w", err))
+	ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	Shutdown(ctx)
+}
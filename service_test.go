@@ -0,0 +1,66 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestServeShutdownOnError(t *testing.T) {
+	ResetCache()
+	defer ResetCache()
+	this.servicePort = "invalid"
+	captureLog(t)
+
+	tests := []struct {
+		name  string
+		serve func(shutdown func(context.Context)) error
+	}{
+		{
+			name: "http",
+			serve: func(shutdown func(context.Context)) error {
+				return ServeHTTP(shutdown, &http.Server{Addr: "localhost:invalid"})
+			},
+		},
+		{
+			name: "grpc",
+			serve: func(shutdown func(context.Context)) error {
+				return ServeGRPC(shutdown, NewGRPCServer())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var hookDeadline bool
+			OnShutdown(func(ctx context.Context) {
+				_, hookDeadline = ctx.Deadline()
+			})
+			called := false
+			err := test.serve(func(context.Context) {
+				called = true
+			})
+			if err == nil {
+				t.Fatal("expected error listening on an invalid port")
+			}
+			if !called {
+				t.Error("expected shutdown func to be called")
+			}
+			if !hookDeadline {
+				t.Error("expected shutdown hook to be called with a deadline")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ConfigView is an immutable copy of the global config store, see
+// ConfigSnapshot, or of the keys sharing a common prefix, see
+// ConfigScope.Snapshot.
+type ConfigView struct {
+	// entries holds all keys by their absolute key, so that references to keys
+	// outside of the prefix can be resolved.
+	entries map[string]configEntry
+	// prefix scopes the view to keys starting with it, which are relative to
+	// the prefix.
+	prefix string
+}
+
+// ConfigSnapshot returns an immutable copy of the global config store.
+// Subsequent changes to the store are not reflected in the snapshot, which
+// allows reading multiple related keys consistently.
+func ConfigSnapshot() ConfigView {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return ConfigView{entries: maps.Clone(config)}
+}
+
+// Get retrieves the value for the key from the snapshot. Secret references
+// and references to other keys of the snapshot are resolved like by GetConfig.
+// References are absolute keys, even in a scoped snapshot.
+func (v ConfigView) Get(key string) (string, error) {
+	key = v.prefix + key
+	entry, ok := v.entries[key]
+	if !ok {
+		return "", fmt.Errorf("no config found for key: '%s'", key)
+	}
+	entry, err := newInterpolator(func(key string) (configEntry, bool) {
+		entry, ok := v.entries[key]
+		return entry, ok
+	}).resolve(key, entry)
+	return entry.value, err
+}
+
+// Has reports whether the snapshot contains the key.
+func (v ConfigView) Has(key string) bool {
+	_, ok := v.entries[v.prefix+key]
+	return ok
+}
+
+// Keys returns the sorted keys of the snapshot.
+func (v ConfigView) Keys() []string {
+	return slices.Sorted(maps.Keys(v.scoped()))
+}
+
+// Len returns the number of keys in the snapshot.
+func (v ConfigView) Len() int {
+	return len(v.scoped())
+}
+
+// List returns a copy of the snapshot in which the values of secret keys are
+// redacted, see ListConfig.
+func (v ConfigView) List() map[string]string {
+	scoped := v.scoped()
+	listing := make(map[string]string, len(scoped))
+	for key, entry := range scoped {
+		listing[key] = entry.redacted()
+	}
+	return listing
+}
+
+// scoped returns the entries of the snapshot by their relative keys.
+func (v ConfigView) scoped() map[string]configEntry {
+	if v.prefix == "" {
+		return v.entries
+	}
+	entries := make(map[string]configEntry)
+	for key, entry := range v.entries {
+		if relative, ok := strings.CutPrefix(key, v.prefix); ok {
+			entries[relative] = entry
+		}
+	}
+	return entries
+}
+
+// ConfigScope is a view of the keys in the global config store sharing a
+// common prefix, see ConfigPrefix.
+type ConfigScope struct {
+	prefix string
+}
+
+// ConfigPrefix returns a view of the global config store which is scoped to
+// keys starting with the prefix, so that modules only see their own keys.
+// Keys passed to and returned by the scope are relative to the prefix:
+//
+//	db := run.ConfigPrefix("db.")
+//	host, err := db.Get("host") // Reads `db.host`
+//	port := run.GetIntOr(db.Key("port"), 5432)
+func ConfigPrefix(prefix string) ConfigScope {
+	return ConfigScope{prefix}
+}
+
+// Prefix returns the prefix of the scope.
+func (s ConfigScope) Prefix() string {
+	return s.prefix
+}
+
+// Key returns the key in the global config store for the relative key, e.g.
+// for use with the typed getters.
+func (s ConfigScope) Key(key string) string {
+	return s.prefix + key
+}
+
+// Get retrieves the value for the relative key from the global config store.
+func (s ConfigScope) Get(key string) (string, error) {
+	return GetConfig(s.Key(key))
+}
+
+// Put adds the value for the relative key to the global config store.
+func (s ConfigScope) Put(key string, val string) {
+	PutConfig(s.Key(key), val)
+}
+
+// Delete removes the relative key from the global config store.
+func (s ConfigScope) Delete(key string) {
+	DeleteConfig(s.Key(key))
+}
+
+// Watch subscribes to changes of the value for the relative key, see
+// WatchConfig.
+func (s ConfigScope) Watch(key string, onChange func(old string, new string)) func() {
+	return WatchConfig(s.Key(key), onChange)
+}
+
+// Keys returns the sorted relative keys of the scope.
+func (s ConfigScope) Keys() []string {
+	return s.Snapshot().Keys()
+}
+
+// Snapshot returns an immutable copy of the keys in the scope. Keys of the
+// snapshot are relative to the prefix, while references in values are
+// resolved against all keys of the store like by GetConfig.
+func (s ConfigScope) Snapshot() ConfigView {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return ConfigView{entries: maps.Clone(config), prefix: s.prefix}
+}
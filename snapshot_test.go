@@ -0,0 +1,113 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConfigSnapshot(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("b", "2")
+	PutConfig("a", "1")
+	snapshot := ConfigSnapshot()
+	PutConfig("a", "changed")
+	DeleteConfig("b")
+
+	if got, err := snapshot.Get("a"); err != nil || got != "1" {
+		t.Fatalf("expected snapshot to keep value 1, got %q, %v", got, err)
+	}
+	if !snapshot.Has("b") {
+		t.Fatal("expected snapshot to keep deleted key")
+	}
+	if got := fmt.Sprint(snapshot.Keys()); got != "[a b]" {
+		t.Fatalf("expected sorted keys [a b], got %s", got)
+	}
+	if got := fmt.Sprint(ListConfigKeys()); got != "[a]" {
+		t.Fatalf("expected keys [a] after delete, got %s", got)
+	}
+}
+
+func TestConfigPrefix(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	PutConfig("db.host", "localhost")
+	PutConfig("cache.host", "redis")
+	db := ConfigPrefix("db.")
+	db.Put("port", "5432")
+
+	if got, err := db.Get("host"); err != nil || got != "localhost" {
+		t.Fatalf("expected localhost, got %q, %v", got, err)
+	}
+	if got := GetIntOr(db.Key("port"), 0); got != 5432 {
+		t.Fatalf("expected port 5432, got %d", got)
+	}
+	if got := fmt.Sprint(db.Keys()); got != "[host port]" {
+		t.Fatalf("expected scoped keys [host port], got %s", got)
+	}
+
+	var changes []string
+	cancel := db.Watch("host", func(old string, new string) {
+		changes = append(changes, old+"->"+new)
+	})
+	defer cancel()
+	db.Delete("host")
+	if got := fmt.Sprint(changes); got != "[localhost->]" {
+		t.Fatalf("expected deletion to be notified, got %s", got)
+	}
+}
+
+func TestConfigConcurrentAccess(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	var wg sync.WaitGroup
+	for i := range contention {
+		key := fmt.Sprintf("key-%d", i%10)
+		wg.Add(5)
+		go func() {
+			defer wg.Done()
+			PutConfig(key, "value")
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = GetConfig(key)
+			_ = CountConfig()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = ConfigSnapshot().Keys()
+			_ = ListConfigKeys()
+		}()
+		go func() {
+			defer wg.Done()
+			DeleteConfig(key)
+		}()
+		go func() {
+			defer wg.Done()
+			if i%25 == 0 {
+				ResetConfig()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := CountConfig(); got > 10 {
+		t.Fatalf("expected at most 10 keys, got %d", got)
+	}
+}
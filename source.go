@@ -0,0 +1,406 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "sigs.k8s.io/yaml"
+)
+
+// ConfigSource provides key/value pairs for the global config store.
+type ConfigSource interface {
+	// Name identifies the source, it is reported by ConfigOrigin.
+	Name() string
+	// Load returns all key/value pairs provided by the source.
+	Load() (map[string]string, error)
+}
+
+// SecretConfigSource is implemented by config sources providing sensitive
+// values, which are redacted from listings and logs.
+type SecretConfigSource interface {
+	ConfigSource
+	Secret() bool
+}
+
+var configSources []ConfigSource
+
+// LoadConfigSources loads all key/value pairs from the sources into the
+// global config store. Sources are supplied in order of precedence: if
+// multiple sources provide the same key, the value of the first one wins.
+//
+//	err := run.LoadConfigSources(
+//		run.FlagSource(nil),
+//		run.EnvSource(),
+//		run.YAMLFileSource("config.yaml"),
+//		run.DefaultsSource(map[string]string{"db.port": "5432"}),
+//	)
+//
+// Values which were loaded from sources before are replaced at once, values
+// stored otherwise, e.g. with PutConfig, are kept unless a source provides the
+// same key. The new config has to pass all hooks registered with
+// ValidateConfig. Sources which fail to load keep their previous values, which
+// still take precedence over sources of lower precedence, and their errors are
+// returned joined.
+func LoadConfigSources(sources ...ConfigSource) error {
+	configMu.Lock()
+	configSources = sources
+	configMu.Unlock()
+	return loadConfigSources(sources)
+}
+
+// ReloadConfig loads all sources supplied to the last call of
+// LoadConfigSources again.
+func ReloadConfig() error {
+	configMu.RLock()
+	sources := configSources
+	configMu.RUnlock()
+	return loadConfigSources(sources)
+}
+
+// isLoadedConfigSource reports whether a source with the name was supplied to
+// the last call of LoadConfigSources.
+func isLoadedConfigSource(name string) bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return slices.ContainsFunc(configSources, func(source ConfigSource) bool {
+		return source.Name() == name
+	})
+}
+
+func loadConfigSources(sources []ConfigSource) error {
+	var errs []error
+	loaded := make(map[string]bool)
+	failed := make(map[string]bool)
+	// precedence maps source names to their position, lower is higher.
+	precedence := make(map[string]int)
+	entries := make(map[string]configEntry)
+	for i, source := range slices.Backward(sources) {
+		precedence[source.Name()] = i
+		values, err := source.Load()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load config source '%s': %w", source.Name(), err))
+			failed[source.Name()] = true
+			continue
+		}
+		loaded[source.Name()] = true
+		secret := isSecretSource(source)
+		for key, val := range values {
+			entries[key] = configEntry{value: val, source: source.Name(), secret: secret}
+		}
+	}
+
+	err := swapConfig(func(next map[string]configEntry) map[string]configEntry {
+		maps.DeleteFunc(next, func(_ string, entry configEntry) bool {
+			return loaded[entry.source]
+		})
+		for key, entry := range entries {
+			// Values kept from failed sources still take precedence.
+			kept, ok := next[key]
+			if ok && failed[kept.source] && precedence[kept.source] < precedence[entry.source] {
+				continue
+			}
+			next[key] = entry
+		}
+		return next
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func isSecretSource(source ConfigSource) bool {
+	secretSource, ok := source.(SecretConfigSource)
+	return ok && secretSource.Secret()
+}
+
+// ConfigOrigin returns the name of the source which provided the current value
+// for the key, e.g. `env` or `yaml:config.yaml`. Values stored with PutConfig
+// originate from `memory`.
+func ConfigOrigin(key string) (string, error) {
+	entry, err := lookupConfigEntry(key)
+	if err != nil {
+		return "", err
+	}
+	return entry.source, nil
+}
+
+type funcSource struct {
+	name string
+	load func() (map[string]string, error)
+}
+
+func (s funcSource) Name() string {
+	return s.name
+}
+
+func (s funcSource) Load() (map[string]string, error) {
+	return s.load()
+}
+
+// EnvSource provides all environment variables.
+func EnvSource() ConfigSource {
+	return funcSource{configSourceEnv, func() (map[string]string, error) {
+		values := make(map[string]string)
+		for _, pair := range os.Environ() {
+			key, value, ok := strings.Cut(pair, "=")
+			if ok {
+				values[key] = value
+			}
+		}
+		return values, nil
+	}}
+}
+
+// DefaultsSource provides a fixed set of in-memory default values. It is
+// typically supplied last to LoadConfigSources.
+func DefaultsSource(defaults map[string]string) ConfigSource {
+	return funcSource{"defaults", func() (map[string]string, error) {
+		return maps.Clone(defaults), nil
+	}}
+}
+
+// FlagSource provides the values of all flags which were explicitly set on the
+// command line. If flags is nil, flag.CommandLine is used. The flags need to
+// be parsed before loading the source.
+func FlagSource(flags *flag.FlagSet) ConfigSource {
+	return funcSource{"flags", func() (map[string]string, error) {
+		if flags == nil {
+			flags = flag.CommandLine
+		}
+		if !flags.Parsed() {
+			return nil, errors.New("flags are not parsed")
+		}
+		values := make(map[string]string)
+		flags.Visit(func(f *flag.Flag) {
+			values[f.Name] = f.Value.String()
+		})
+		return values, nil
+	}}
+}
+
+// DotEnvSource provides the variables declared in a `.env` file. Lines are
+// expected in the form `KEY=VALUE`, optionally prefixed with `export`. Values
+// may be quoted, comments start with `#`.
+func DotEnvSource(path string) ConfigSource {
+	return funcSource{"dotenv:" + path, func() (map[string]string, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return parseDotEnv(content)
+	}}
+}
+
+// JSONFileSource provides the values of a JSON file. Nested objects are
+// flattened into dot-separated keys, e.g. `{"db": {"port": 5432}}` provides
+// `db.port`. Arrays are joined by commas.
+func JSONFileSource(path string) ConfigSource {
+	return funcSource{"json:" + path, func() (map[string]string, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return flattenJSON(content)
+	}}
+}
+
+// YAMLFileSource provides the values of a YAML file. Nested mappings are
+// flattened into dot-separated keys and sequences are joined by commas.
+func YAMLFileSource(path string) ConfigSource {
+	return funcSource{"yaml:" + path, func() (map[string]string, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content, err = yaml.YAMLToJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		return flattenJSON(content)
+	}}
+}
+
+// SecretVolume is a config source providing secrets from Secret Manager
+// which are mounted as files into the container.
+type SecretVolume struct {
+	dirs []string
+}
+
+// SecretVolumeSource provides the contents of all files in the given mount
+// directories as secret values. Keys are the paths of the files relative to
+// their mount directory with separators replaced by dots, e.g. the secret
+// mounted at `/secrets/db/password` is provided as `db.password` for the
+// directory `/secrets`. Hidden files and directories are skipped.
+func SecretVolumeSource(dirs ...string) *SecretVolume {
+	return &SecretVolume{dirs}
+}
+
+// Name identifies the source.
+func (v *SecretVolume) Name() string {
+	return "secrets:" + strings.Join(v.dirs, ",")
+}
+
+// Secret marks all values provided by the source as secret.
+func (v *SecretVolume) Secret() bool {
+	return true
+}
+
+// Load reads all secrets from the mount directories.
+func (v *SecretVolume) Load() (map[string]string, error) {
+	values := make(map[string]string)
+	for _, dir := range v.dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				// Skips the internals of atomically updated volumes, e.g. `..data`
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+
+			// Mounted secrets tend to be symlinks
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			key := strings.ReplaceAll(filepath.ToSlash(rel), "/", ".")
+			values[key] = strings.TrimSuffix(string(content), "\n")
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Watch polls the mounted secrets in the given interval and reloads them when
+// they change, as mounted secrets pinned to `latest` are updated in place. If
+// the volume was supplied to LoadConfigSources, all sources are reloaded with
+// ReloadConfig to respect their precedence, otherwise only the secrets of the
+// volume are reloaded. Watch blocks until the context is done.
+func (v *SecretVolume) Watch(ctx context.Context, interval time.Duration) {
+	pollConfigSources(ctx, interval, func() []ConfigSource {
+		return []ConfigSource{v}
+	}, func() error {
+		if isLoadedConfigSource(v.Name()) {
+			return ReloadConfig()
+		}
+		return loadConfigSources([]ConfigSource{v})
+	})
+}
+
+func parseDotEnv(content []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("line %d: unterminated quote", lineNumber)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			// Strip trailing comments of unquoted values
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func flattenJSON(content []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flattenValue(values, "", object)
+	return values, nil
+}
+
+func flattenValue(values map[string]string, key string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for childKey, child := range v {
+			if key != "" {
+				childKey = key + "." + childKey
+			}
+			flattenValue(values, childKey, child)
+		}
+	case []any:
+		elems := make([]string, 0, len(v))
+		for _, elem := range v {
+			elems = append(elems, fmt.Sprint(elem))
+		}
+		values[key] = strings.Join(elems, ",")
+	case nil:
+		values[key] = ""
+	default:
+		values[key] = fmt.Sprint(v)
+	}
+}
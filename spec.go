@@ -0,0 +1,228 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerPort is a port declared by the serving container.
+type ContainerPort struct {
+	// Name is the protocol of the port, either `http1` or `h2c`.
+	Name string `json:"name,omitempty"`
+	Port int    `json:"port"`
+}
+
+// EnvVar is an environment variable declared for the serving container.
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	// Secret references the Secret Manager secret providing the value in the
+	// form `<secret>:<version>`, if any.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Probe is a startup or liveness probe of the serving container.
+type Probe struct {
+	// Type is the kind of check, either `http`, `tcp` or `grpc`.
+	Type string `json:"type"`
+	// Path is the requested path of HTTP probes.
+	Path string `json:"path,omitempty"`
+	// Service is the checked service of GRPC probes.
+	Service          string        `json:"service,omitempty"`
+	Port             int           `json:"port,omitempty"`
+	InitialDelay     time.Duration `json:"initialDelay"`
+	Timeout          time.Duration `json:"timeout"`
+	Period           time.Duration `json:"period"`
+	FailureThreshold int           `json:"failureThreshold"`
+}
+
+// CPULimit returns the number of CPUs the serving container is limited to,
+// e.g. `0.5` or `2`.
+func CPULimit() (float64, error) {
+	container, err := specContainer("resources.limits.cpu")
+	if err != nil {
+		return 0, err
+	}
+	limit, ok := container.Resources.Limits[corev1.ResourceCPU]
+	if !ok {
+		return 0, errors.New("error reading property 'resources.limits.cpu'")
+	}
+	return limit.AsApproximateFloat64(), nil
+}
+
+// MemoryLimit returns the number of bytes of memory the serving container is
+// limited to.
+func MemoryLimit() (int64, error) {
+	container, err := specContainer("resources.limits.memory")
+	if err != nil {
+		return 0, err
+	}
+	limit, ok := container.Resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return 0, errors.New("error reading property 'resources.limits.memory'")
+	}
+	return limit.Value(), nil
+}
+
+// ContainerConcurrency returns the maximum number of concurrent requests per
+// instance.
+func ContainerConcurrency() (int, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return 0, fmt.Errorf("error loading property 'containerConcurrency': %v", err)
+	}
+	concurrency := service.Spec.Template.Spec.ContainerConcurrency
+	if concurrency == nil {
+		return 0, errors.New("error reading property 'containerConcurrency'")
+	}
+	return int(*concurrency), nil
+}
+
+// RequestTimeout returns the time within which requests have to be
+// responded to.
+func RequestTimeout() (time.Duration, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return 0, fmt.Errorf("error loading property 'timeoutSeconds': %v", err)
+	}
+	timeout := service.Spec.Template.Spec.TimeoutSeconds
+	if timeout == nil {
+		return 0, errors.New("error reading property 'timeoutSeconds'")
+	}
+	return time.Duration(*timeout) * time.Second, nil
+}
+
+// ServiceAccountName returns the email of the service account the revision
+// runs as, as declared in the service spec. See ServiceAccountEmail for the
+// account reported by the metadata server.
+func ServiceAccountName() (string, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return "", fmt.Errorf("error loading property 'serviceAccountName': %v", err)
+	}
+	name := service.Spec.Template.Spec.ServiceAccountName
+	if name == "" {
+		return "", errors.New("error reading property 'serviceAccountName'")
+	}
+	return name, nil
+}
+
+// ContainerPorts returns the ports declared by the serving container.
+func ContainerPorts() ([]ContainerPort, error) {
+	container, err := specContainer("ports")
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]ContainerPort, 0, len(container.Ports))
+	for _, port := range container.Ports {
+		ports = append(ports, ContainerPort{Name: port.Name, Port: int(port.ContainerPort)})
+	}
+	return ports, nil
+}
+
+// DeclaredEnv returns the environment variables declared for the serving
+// container in order of declaration.
+func DeclaredEnv() ([]EnvVar, error) {
+	container, err := specContainer("env")
+	if err != nil {
+		return nil, err
+	}
+	env := make([]EnvVar, 0, len(container.Env))
+	for _, declared := range container.Env {
+		envVar := EnvVar{Name: declared.Name, Value: declared.Value}
+		if declared.ValueFrom != nil && declared.ValueFrom.SecretKeyRef != nil {
+			ref := declared.ValueFrom.SecretKeyRef
+			envVar.Secret = ref.Name + ":" + ref.Key
+		}
+		env = append(env, envVar)
+	}
+	return env, nil
+}
+
+// StartupProbe returns the startup probe of the serving container or nil if
+// none is configured.
+func StartupProbe() (*Probe, error) {
+	container, err := specContainer("startupProbe")
+	if err != nil {
+		return nil, err
+	}
+	return newProbe(container.StartupProbe), nil
+}
+
+// LivenessProbe returns the liveness probe of the serving container or nil
+// if none is configured.
+func LivenessProbe() (*Probe, error) {
+	container, err := specContainer("livenessProbe")
+	if err != nil {
+		return nil, err
+	}
+	return newProbe(container.LivenessProbe), nil
+}
+
+func newProbe(probe *corev1.Probe) *Probe {
+	if probe == nil {
+		return nil
+	}
+	p := &Probe{
+		InitialDelay:     time.Duration(probe.InitialDelaySeconds) * time.Second,
+		Timeout:          time.Duration(probe.TimeoutSeconds) * time.Second,
+		Period:           time.Duration(probe.PeriodSeconds) * time.Second,
+		FailureThreshold: int(probe.FailureThreshold),
+	}
+	switch {
+	case probe.HTTPGet != nil:
+		p.Type = "http"
+		p.Path = probe.HTTPGet.Path
+		p.Port = probe.HTTPGet.Port.IntValue()
+	case probe.TCPSocket != nil:
+		p.Type = "tcp"
+		p.Port = probe.TCPSocket.Port.IntValue()
+	case probe.GRPC != nil:
+		p.Type = "grpc"
+		p.Port = int(probe.GRPC.Port)
+		if probe.GRPC.Service != nil {
+			p.Service = *probe.GRPC.Service
+		}
+	}
+	return p
+}
+
+// specContainer returns the serving container of the current service for
+// reading the named property.
+func specContainer(property string) (corev1.Container, error) {
+	service, err := KNativeService()
+	if err != nil {
+		return corev1.Container{}, fmt.Errorf("error loading property '%s': %v", property, err)
+	}
+	containers := service.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return corev1.Container{}, fmt.Errorf("error reading property '%s': no containers declared", property)
+	}
+	return servingContainer(containers), nil
+}
+
+// servingContainer returns the container receiving requests, which is the
+// only one declaring a port if sidecars are deployed.
+func servingContainer(containers []corev1.Container) corev1.Container {
+	for _, container := range containers {
+		if len(container.Ports) > 0 {
+			return container
+		}
+	}
+	return containers[0]
+}
@@ -0,0 +1,85 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSpecAccessors(t *testing.T) {
+	type accessor struct {
+		name     string
+		get      func() (any, error)
+		expected any
+		err      bool
+	}
+	cpu := func() (any, error) { return CPULimit() }
+	memory := func() (any, error) { return MemoryLimit() }
+	concurrency := func() (any, error) { return ContainerConcurrency() }
+	timeout := func() (any, error) { return RequestTimeout() }
+	account := func() (any, error) { return ServiceAccountName() }
+	ports := func() (any, error) { return ContainerPorts() }
+	env := func() (any, error) { return DeclaredEnv() }
+	startup := func() (any, error) { return StartupProbe() }
+	liveness := func() (any, error) { return LivenessProbe() }
+
+	tests := []struct {
+		fixture   string
+		accessors []accessor
+	}{
+		{"service.yaml", []accessor{
+			{"CPULimit", cpu, 2.0, false},
+			{"MemoryLimit", memory, int64(1 << 30), false},
+			{"ContainerConcurrency", concurrency, 80, false},
+			{"RequestTimeout", timeout, 5 * time.Minute, false},
+			{"ServiceAccountName", account, "runner@my-project.iam.gserviceaccount.com", false},
+			{"ContainerPorts", ports, []ContainerPort{{"http1", 8080}}, false},
+			{"DeclaredEnv", env, []EnvVar{
+				{Name: "DB_HOST", Value: "10.0.0.2"},
+				{Name: "DB_PASSWORD", Secret: "db-password:latest"},
+				{Name: "DATABASE_URL", Secret: "database-url:1"},
+			}, false},
+			{"StartupProbe", startup, &Probe{
+				Type: "tcp", Port: 8080, Timeout: 4 * time.Minute, Period: 4 * time.Minute, FailureThreshold: 1,
+			}, false},
+			{"LivenessProbe", liveness, &Probe{
+				Type: "http", Path: "/uptimez", Port: 8080, InitialDelay: 10 * time.Second, Period: 30 * time.Second, FailureThreshold: 3,
+			}, false},
+		}},
+		{"service.json", []accessor{
+			{"CPULimit", cpu, 1.0, false},
+			{"MemoryLimit", memory, int64(512 << 20), false},
+			{"ContainerConcurrency", concurrency, 0, true},
+			{"RequestTimeout", timeout, time.Duration(0), true},
+			{"ServiceAccountName", account, "", true},
+			{"ContainerPorts", ports, []ContainerPort{}, false},
+			{"StartupProbe", startup, (*Probe)(nil), false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			loadServiceFixture(t, tt.fixture)
+			for _, a := range tt.accessors {
+				got, err := a.get()
+				if (err != nil) != a.err {
+					t.Errorf("%s: expected error %t, got %v", a.name, a.err, err)
+				}
+				if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", a.expected) {
+					t.Errorf("%s: expected %+v, got %+v", a.name, a.expected, got)
+				}
+			}
+		})
+	}
+}
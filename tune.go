@@ -0,0 +1,230 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCgroupRoot     = "/sys/fs/cgroup"
+	defaultMemoryHeadroom = 0.1
+	// cgroupV1Unlimited is the lower bound of values cgroup v1 reports for
+	// unlimited memory, which is the maximum int64 rounded down to the page
+	// size.
+	cgroupV1Unlimited = 1 << 62
+
+	limitSourceCgroupV1 = "cgroup v1"
+	limitSourceCgroupV2 = "cgroup v2"
+	limitSourceSpec     = "service spec"
+	limitSourceEnv      = "env"
+)
+
+// TuneOption configures the behaviour of TuneRuntime.
+type TuneOption func(*tuneConfig)
+
+type tuneConfig struct {
+	cgroupRoot     string
+	memoryHeadroom float64
+}
+
+// TuneCgroupRoot sets the directory the cgroup file system is mounted at,
+// which defaults to `/sys/fs/cgroup`.
+func TuneCgroupRoot(root string) TuneOption {
+	return func(cfg *tuneConfig) {
+		cfg.cgroupRoot = root
+	}
+}
+
+// TuneMemoryHeadroom sets the fraction of the memory limit which is reserved
+// for memory not managed by the Go runtime, e.g. `0.1` sets GOMEMLIMIT to 90%
+// of the memory limit. It defaults to 10%, values outside of [0, 1) are
+// ignored.
+func TuneMemoryHeadroom(fraction float64) TuneOption {
+	return func(cfg *tuneConfig) {
+		if fraction >= 0 && fraction < 1 {
+			cfg.memoryHeadroom = fraction
+		}
+	}
+}
+
+// RuntimeTuning reports the limits detected and the settings chosen by
+// TuneRuntime.
+type RuntimeTuning struct {
+	// CPULimit is the number of CPUs the container is limited to, 0 if no
+	// limit was detected.
+	CPULimit float64 `json:"cpuLimit"`
+	// CPUSource is where the CPU limit was detected, e.g. `cgroup v2`.
+	CPUSource string `json:"cpuSource,omitempty"`
+	// MemoryLimit is the number of bytes the container is limited to, 0 if
+	// no limit was detected.
+	MemoryLimit int64 `json:"memoryLimit"`
+	// MemorySource is where the memory limit was detected.
+	MemorySource string `json:"memorySource,omitempty"`
+	GOMAXPROCS   int    `json:"gomaxprocs"`
+	GOMEMLIMIT   int64  `json:"gomemlimit"`
+}
+
+// TuneRuntime adapts the Go runtime to the limits of the container, which it
+// otherwise does not know about. GOMAXPROCS is set to the CPU limit rounded
+// down, but at least 1, so that the container is not throttled for exceeding
+// its CPU quota, and GOMEMLIMIT to the memory limit minus the headroom, see
+// TuneMemoryHeadroom, so that the garbage collector works harder before the
+// container runs out of memory.
+//
+// Limits are read from cgroup v2 or v1 and fall back to the limits declared
+// in the service spec, see CPULimit and MemoryLimit. Settings supplied with
+// the GOMAXPROCS and GOMEMLIMIT environment variables take precedence. The
+// chosen settings are logged and returned.
+//
+// TuneRuntime should be called early in main.
+func TuneRuntime(opts ...TuneOption) RuntimeTuning {
+	cfg := &tuneConfig{
+		cgroupRoot:     defaultCgroupRoot,
+		memoryHeadroom: defaultMemoryHeadroom,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	tuning := RuntimeTuning{}
+	tuning.CPULimit, tuning.CPUSource = detectCPULimit(cfg.cgroupRoot)
+	tuning.MemoryLimit, tuning.MemorySource = detectMemoryLimit(cfg.cgroupRoot)
+
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		tuning.CPUSource = limitSourceEnv
+	case tuning.CPULimit > 0:
+		runtime.GOMAXPROCS(max(1, int(math.Floor(tuning.CPULimit))))
+	}
+	tuning.GOMAXPROCS = runtime.GOMAXPROCS(0)
+
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		tuning.MemorySource = limitSourceEnv
+	case tuning.MemoryLimit > 0:
+		debug.SetMemoryLimit(int64(float64(tuning.MemoryLimit) * (1 - cfg.memoryHeadroom)))
+	}
+	tuning.GOMEMLIMIT = debug.SetMemoryLimit(-1)
+
+	Infof(nil, "tuned runtime: GOMAXPROCS=%d (CPU limit %g from %s), GOMEMLIMIT=%d (memory limit %d from %s, headroom %g)",
+		tuning.GOMAXPROCS, tuning.CPULimit, limitSource(tuning.CPUSource),
+		tuning.GOMEMLIMIT, tuning.MemoryLimit, limitSource(tuning.MemorySource), cfg.memoryHeadroom)
+	return tuning
+}
+
+func limitSource(source string) string {
+	if source == "" {
+		return "nowhere"
+	}
+	return source
+}
+
+// detectCPULimit returns the CPU limit from cgroups, falling back to the
+// service spec.
+func detectCPULimit(root string) (float64, string) {
+	if limit, ok := readCgroupV2CPU(root); ok {
+		return limit, limitSourceCgroupV2
+	}
+	if limit, ok := readCgroupV1CPU(root); ok {
+		return limit, limitSourceCgroupV1
+	}
+	if limit, err := CPULimit(); err == nil && limit > 0 {
+		return limit, limitSourceSpec
+	}
+	return 0, ""
+}
+
+// detectMemoryLimit returns the memory limit from cgroups, falling back to
+// the service spec.
+func detectMemoryLimit(root string) (int64, string) {
+	if limit, ok := readCgroupV2Memory(root); ok {
+		return limit, limitSourceCgroupV2
+	}
+	if limit, ok := readCgroupV1Memory(root); ok {
+		return limit, limitSourceCgroupV1
+	}
+	if limit, err := MemoryLimit(); err == nil && limit > 0 {
+		return limit, limitSourceSpec
+	}
+	return 0, ""
+}
+
+// readCgroupV2CPU parses `cpu.max`, which holds the quota and period in the
+// form `200000 100000` or `max 100000` if unlimited.
+func readCgroupV2CPU(root string) (float64, bool) {
+	fields := strings.Fields(readCgroupFile(root, "cpu.max"))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+	return cpuQuota(fields[0], fields[1])
+}
+
+// readCgroupV1CPU parses the CFS quota and period, where a quota of `-1`
+// denotes no limit.
+func readCgroupV1CPU(root string) (float64, bool) {
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		quota := readCgroupFile(root, filepath.Join(dir, "cpu.cfs_quota_us"))
+		period := readCgroupFile(root, filepath.Join(dir, "cpu.cfs_period_us"))
+		if limit, ok := cpuQuota(quota, period); ok {
+			return limit, true
+		}
+	}
+	return 0, false
+}
+
+func cpuQuota(quota string, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
+
+// readCgroupV2Memory parses `memory.max`, which holds the limit in bytes or
+// `max` if unlimited.
+func readCgroupV2Memory(root string) (int64, bool) {
+	limit, err := strconv.ParseInt(readCgroupFile(root, "memory.max"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+func readCgroupV1Memory(root string) (int64, bool) {
+	limit, err := strconv.ParseInt(readCgroupFile(root, filepath.Join("memory", "memory.limit_in_bytes")), 10, 64)
+	if err != nil || limit <= 0 || limit >= cgroupV1Unlimited {
+		return 0, false
+	}
+	return limit, true
+}
+
+// readCgroupFile returns the trimmed content of the file relative to the
+// cgroup root or an empty string if it cannot be read.
+func readCgroupFile(root string, name string) string {
+	content, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
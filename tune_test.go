@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestTuneRuntime(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		fixture  string
+		env      map[string]string
+		opts     []TuneOption
+		expected RuntimeTuning
+	}{
+		{
+			name: "cgroup v2",
+			files: map[string]string{
+				"cpu.max":    "150000 100000\n",
+				"memory.max": "1073741824\n",
+			},
+			expected: RuntimeTuning{1.5, limitSourceCgroupV2, 1 << 30, limitSourceCgroupV2, 1, 966367641},
+		},
+		{
+			name: "fractional CPU limit below 1",
+			files: map[string]string{
+				"cpu.max":    "50000 100000\n",
+				"memory.max": "1073741824\n",
+			},
+			expected: RuntimeTuning{0.5, limitSourceCgroupV2, 1 << 30, limitSourceCgroupV2, 1, 966367641},
+		},
+		{
+			name: "cgroup v1",
+			files: map[string]string{
+				"cpu,cpuacct/cpu.cfs_quota_us":  "400000\n",
+				"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+				"memory/memory.limit_in_bytes":  "536870912\n",
+			},
+			opts:     []TuneOption{TuneMemoryHeadroom(0.25)},
+			expected: RuntimeTuning{4, limitSourceCgroupV1, 512 << 20, limitSourceCgroupV1, 4, 384 << 20},
+		},
+		{
+			name: "unlimited cgroup falls back to service spec",
+			files: map[string]string{
+				"cpu.max":    "max 100000\n",
+				"memory.max": "max\n",
+			},
+			fixture:  "service.json",
+			expected: RuntimeTuning{1, limitSourceSpec, 512 << 20, limitSourceSpec, 1, 483183820},
+		},
+		{
+			name: "environment takes precedence",
+			files: map[string]string{
+				"cpu.max":    "200000 100000\n",
+				"memory.max": "1073741824\n",
+			},
+			env:      map[string]string{"GOMAXPROCS": "3", "GOMEMLIMIT": "100MiB"},
+			expected: RuntimeTuning{2, limitSourceEnv, 1 << 30, limitSourceEnv, 3, 100 << 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetCache()
+			defer ResetCache()
+			if tt.fixture != "" {
+				loadServiceFixture(t, tt.fixture)
+			}
+			t.Setenv("GOMAXPROCS", "")
+			t.Setenv("GOMEMLIMIT", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			// Settings from the environment are applied by the runtime at
+			// startup, which is simulated here.
+			runtime.GOMAXPROCS(3)
+			debug.SetMemoryLimit(100 << 20)
+
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					t.Fatalf("failed to create %s: %v", path, err)
+				}
+				writeFile(t, path, content)
+			}
+
+			got := TuneRuntime(append(tt.opts, TuneCgroupRoot(root))...)
+			if got != tt.expected {
+				t.Fatalf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTuneRuntimeWithoutLimits(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(math.MaxInt64))
+	ResetCache()
+	defer ResetCache()
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	procs := runtime.GOMAXPROCS(0)
+	got := TuneRuntime(TuneCgroupRoot(t.TempDir()))
+	if got.CPUSource != "" || got.MemorySource != "" {
+		t.Fatalf("expected no limits to be detected, got %+v", got)
+	}
+	if got.GOMAXPROCS != procs || got.GOMEMLIMIT != math.MaxInt64 {
+		t.Fatalf("expected runtime settings to be unchanged, got %+v", got)
+	}
+}
@@ -0,0 +1,241 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+type configWatcher struct {
+	id       uint64
+	key      string
+	onChange func(old string, new string)
+}
+
+var (
+	configWatchers   []configWatcher
+	configWatcherID  uint64
+	configValidators []func(map[string]string) error
+	configWatchMu    sync.Mutex
+	// configWriteMu serializes writers of the global config store, so that
+	// reloads can be validated without holding configMu.
+	configWriteMu sync.Mutex
+
+	// configNotifyMu guards the queue of changes to be delivered to
+	// subscribers and whether a goroutine is delivering them.
+	configNotifyMu    sync.Mutex
+	configNotifyQueue []configChange
+	configNotifying   bool
+)
+
+// WatchConfig subscribes to changes of the value for the key in the global
+// config store, e.g. by PutConfig or a reload of the config sources. The
+// callback receives the old and new value, where an empty value denotes a
+// missing key. It returns a func to cancel the subscription.
+//
+// Changes are delivered one at a time in the order they were made. A change
+// made while another goroutine delivers changes is delivered by that
+// goroutine, so the write may return before the callback was called.
+func WatchConfig(key string, onChange func(old string, new string)) func() {
+	configWatchMu.Lock()
+	defer configWatchMu.Unlock()
+	configWatcherID++
+	id := configWatcherID
+	configWatchers = append(configWatchers, configWatcher{id, key, onChange})
+
+	return func() {
+		configWatchMu.Lock()
+		defer configWatchMu.Unlock()
+		configWatchers = slices.DeleteFunc(configWatchers, func(w configWatcher) bool {
+			return w.id == id
+		})
+	}
+}
+
+// ValidateConfig registers a validation hook for reloads of the config
+// sources. The hook receives the complete, reloaded config. If it returns an
+// error, the reload is rejected and the previous config stays in place.
+// Hooks must not modify the global config store.
+func ValidateConfig(validate func(config map[string]string) error) {
+	configWatchMu.Lock()
+	defer configWatchMu.Unlock()
+	configValidators = append(configValidators, validate)
+}
+
+// WatchConfigSources polls all sources supplied to LoadConfigSources in the
+// given interval and reloads them with ReloadConfig when any of them changes,
+// e.g. when a config file is modified. WatchConfigSources blocks until the
+// context is done.
+func WatchConfigSources(ctx context.Context, interval time.Duration) {
+	pollConfigSources(ctx, interval, func() []ConfigSource {
+		configMu.RLock()
+		defer configMu.RUnlock()
+		return configSources
+	}, ReloadConfig)
+}
+
+// pollConfigSources calls reload whenever the values provided by the watched
+// sources change.
+func pollConfigSources(ctx context.Context, interval time.Duration, watched func() []ConfigSource, reload func() error) {
+	last := make(map[string]map[string]string)
+	for _, source := range watched() {
+		last[source.Name()], _ = source.Load()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := []string{}
+		for _, source := range watched() {
+			current, err := source.Load()
+			if err != nil {
+				Warningf(nil, "failed to poll config source '%s': %v", source.Name(), err)
+				continue
+			}
+			previous, known := last[source.Name()]
+			if known && maps.Equal(previous, current) {
+				continue
+			}
+			last[source.Name()] = current
+			if known {
+				changed = append(changed, source.Name())
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		Infof(nil, "config sources changed, reloading: %v", changed)
+		if err := reload(); err != nil {
+			Warningf(nil, "failed to reload config: %v", err)
+		}
+	}
+}
+
+// swapConfig replaces the global config store with the result of update.
+// The update is validated with all registered validation hooks and swapped
+// in at once, so that readers never observe a partially applied update.
+func swapConfig(update func(current map[string]configEntry) map[string]configEntry) error {
+	configWriteMu.Lock()
+
+	configMu.RLock()
+	current := config
+	configMu.RUnlock()
+
+	next := update(maps.Clone(current))
+	if err := validateConfig(next); err != nil {
+		configWriteMu.Unlock()
+		return err
+	}
+
+	configMu.Lock()
+	config = next
+	configMu.Unlock()
+
+	queueConfigChanges(current, next)
+	configWriteMu.Unlock()
+
+	notifyConfigWatchers()
+	return nil
+}
+
+func validateConfig(next map[string]configEntry) error {
+	configWatchMu.Lock()
+	validators := slices.Clone(configValidators)
+	configWatchMu.Unlock()
+	if len(validators) == 0 {
+		return nil
+	}
+
+	snapshot := make(map[string]string, len(next))
+	for key, entry := range next {
+		snapshot[key] = entry.value
+	}
+	var errs []error
+	for _, validate := range validators {
+		if err := validate(snapshot); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config rejected by validation: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// configChange is a change of a value to be delivered to a subscriber.
+type configChange struct {
+	onChange func(old string, new string)
+	old      string
+	new      string
+}
+
+// queueConfigChanges queues the changes for the subscribers of all keys whose
+// values differ between old and new. Writers queue the changes while holding
+// configWriteMu, so that they are queued in commit order, but deliver them with
+// notifyConfigWatchers after releasing it, so that subscribers may write to the
+// config store.
+func queueConfigChanges(old map[string]configEntry, new map[string]configEntry) {
+	configWatchMu.Lock()
+	var changes []configChange
+	for _, watcher := range configWatchers {
+		oldValue := old[watcher.key].value
+		newValue := new[watcher.key].value
+		if oldValue != newValue {
+			changes = append(changes, configChange{watcher.onChange, oldValue, newValue})
+		}
+	}
+	configWatchMu.Unlock()
+
+	configNotifyMu.Lock()
+	defer configNotifyMu.Unlock()
+	configNotifyQueue = append(configNotifyQueue, changes...)
+}
+
+// notifyConfigWatchers delivers the queued changes in order. Only one
+// goroutine delivers at a time, if another one is already delivering, it also
+// delivers the changes queued by the caller. Changes queued by subscribers are
+// delivered after the current change. It must not be called while holding
+// configWriteMu.
+func notifyConfigWatchers() {
+	configNotifyMu.Lock()
+	defer configNotifyMu.Unlock()
+	if configNotifying {
+		return
+	}
+	configNotifying = true
+	defer func() {
+		configNotifying = false
+	}()
+	for len(configNotifyQueue) > 0 {
+		change := configNotifyQueue[0]
+		configNotifyQueue = configNotifyQueue[1:]
+		func() {
+			configNotifyMu.Unlock()
+			defer configNotifyMu.Lock()
+			change.onChange(change.old, change.new)
+		}()
+	}
+}
@@ -0,0 +1,170 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchConfig(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	var mu sync.Mutex
+	changes := [][2]string{}
+	cancel := WatchConfig("key", func(old string, new string) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, [2]string{old, new})
+	})
+
+	PutConfig("key", "a")
+	PutConfig("key", "a") // Unchanged
+	PutConfig("other", "x")
+	PutConfig("key", "b")
+	cancel()
+	PutConfig("key", "c")
+
+	expected := [][2]string{{"", "a"}, {"a", "b"}}
+	if len(changes) != len(expected) || changes[0] != expected[0] || changes[1] != expected[1] {
+		t.Fatalf("expected changes %v, got %v", expected, changes)
+	}
+}
+
+func TestWatchConfigWritesFromCallback(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	cancelA := WatchConfig("A", func(_ string, new string) {
+		if new != "" {
+			PutConfig("B", new)
+			_ = MarkConfigSecret("B")
+		}
+	})
+	defer cancelA()
+	cancelB := WatchConfig("B", func(_ string, new string) {
+		if new == "" {
+			DeleteConfig("A")
+		}
+	})
+	defer cancelB()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		PutConfig("A", "x")
+		DeleteConfig("B")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writing config from a watch callback deadlocked")
+	}
+
+	if got := ListConfigKeys(); len(got) != 0 {
+		t.Fatalf("expected callbacks to have deleted all keys, got %v", got)
+	}
+}
+
+func TestWatchConfigOrder(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+
+	type change struct{ old, new string }
+	var changes []change
+	cancel := WatchConfig("key", func(old string, new string) {
+		changes = append(changes, change{old, new})
+	})
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range contention {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			PutConfig("key", fmt.Sprint(i))
+		}()
+	}
+	wg.Wait()
+
+	// Every change has to start from the value of the previous one.
+	previous := ""
+	for _, c := range changes {
+		if c.old != previous {
+			t.Fatalf("expected change from %q, got %q -> %q", previous, c.old, c.new)
+		}
+		previous = c.new
+	}
+	if value, _ := GetConfig("key"); value != previous {
+		t.Fatalf("expected last change to %q, got %q", value, previous)
+	}
+}
+
+func TestWatchConfigSources(t *testing.T) {
+	ResetConfig()
+	defer ResetConfig()
+	defer func() {
+		configValidators = nil
+		configWatchers = nil
+	}()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"db": {"host": "a", "port": "5432"}}`)
+
+	ValidateConfig(func(config map[string]string) error {
+		if config["db.port"] == "" {
+			return errors.New("db.port is required")
+		}
+		return nil
+	})
+	if err := LoadConfigSources(JSONFileSource(path)); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	changed := make(chan string, 1)
+	WatchConfig("db.host", func(_ string, new string) {
+		changed <- new
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchConfigSources(ctx, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	// Rejected by validation
+	writeFile(t, path, `{"db": {"host": "invalid"}}`)
+	select {
+	case host := <-changed:
+		t.Fatalf("expected invalid reload to be rejected, got %q", host)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if val, _ := GetConfig("db.host"); val != "a" {
+		t.Fatalf("expected previous value after rejected reload, got %q", val)
+	}
+
+	writeFile(t, path, `{"db": {"host": "b", "port": "5432"}}`)
+	select {
+	case host := <-changed:
+		if host != "b" {
+			t.Fatalf("expected new value, got %q", host)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected reload after file change")
+	}
+}